@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// errBatchIP is returned when an entry of batch has no valid IP,
+// which would otherwise log in the host running the batch
+var errBatchIP = errors.New("batch entry needs a valid ip")
+
+// batchIPError is errBatchIP of a JSON entry
+type batchIPError struct {
+	// Entry number from 1
+	Entry int
+	IP    string
+}
+
+// Error implements the error interface for batchIPError
+func (e *batchIPError) Error() string {
+	return errBatchIP.Error() + ": entry " + strconv.Itoa(e.Entry) + " " + strconv.Quote(e.IP)
+}
+
+// Unwrap returns errBatchIP
+func (e *batchIPError) Unwrap() error {
+	return errBatchIP
+}
+
+// loadBatch reads entries from a JSON file in the format of -profiles,
+// or a CSV file of columns: ip, username, password, type, an optional header is skipped.
+// Every entry must have a valid IP.
+func loadBatch(file string) ([]profile, error) {
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		entries, err := loadProfiles(file)
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			if _, err := netip.ParseAddr(entries[i].IP); err != nil {
+				return nil, &batchIPError{Entry: i + 1, IP: entries[i].IP}
+			}
+		}
+		return entries, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	var entries []profile
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, col := r.FieldPos(0)
+		if len(rec) < 3 {
+			return nil, &csv.ParseError{StartLine: line, Line: line, Column: col, Err: csv.ErrFieldCount}
+		}
+		if strings.EqualFold(rec[0], "ip") {
+			continue
+		}
+		if _, err := netip.ParseAddr(rec[0]); err != nil {
+			return nil, &csv.ParseError{StartLine: line, Line: line, Column: col, Err: errBatchIP}
+		}
+		pf := profile{IP: rec[0], Username: rec[1], Password: rec[2], Type: string(portal.LoginTypeQshEdu)}
+		if len(rec) > 3 && rec[3] != "" {
+			pf.Type = rec[3]
+		}
+		pf.Name = pf.Username
+		entries = append(entries, pf)
+	}
+	return entries, nil
+}
+
+// batchResult of one entry
+type batchResult struct {
+	entry    *profile
+	onlineIP string
+	err      error
+}
+
+// runBatch logs in entries with at most jobs at the same time
+func runBatch(entries []profile, jobs int, configure func(*portal.Portal)) []batchResult {
+	if jobs <= 0 {
+		jobs = 1
+	}
+	results := make([]batchResult, len(entries))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i := range entries {
+		results[i].entry = &entries[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(res *batchResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			e := res.entry
+			ptl, err := portal.NewPortal(e.Username, e.Password, e.Server, e.IP, portal.LoginType(e.Type))
+			if err == nil {
+				configure(ptl)
+				_, err = login(ptl, true, false, false)
+				res.onlineIP = ptl.OnlineIP()
+			}
+			res.err = err
+			if err != nil {
+				logrus.Warnln("batch login", e.IP, e.Username, "failed:", err)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// writeBatchReport writes results as CSV
+func writeBatchReport(w io.Writer, results []batchResult) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"ip", "username", "type", "result", "online_ip", "error_kind", "error"})
+	for _, r := range results {
+		result, kind, msg := "success", "", ""
+		if r.err != nil {
+			result, kind, msg = "failure", string(portal.Classify(r.err)), portal.Redact(r.err.Error())
+		}
+		_ = cw.Write([]string{r.entry.IP, r.entry.Username, r.entry.Type, result, r.onlineIP, kind, msg})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// batchEntryResult of one entry in batch command result
+type batchEntryResult struct {
+	IP       string       `json:"ip"`
+	UserName string       `json:"username"`
+	Type     string       `json:"type"`
+	OK       bool         `json:"ok"`
+	OnlineIP string       `json:"online_ip"`
+	Error    *resultError `json:"error,omitempty"`
+}
+
+// batchResults of batch command
+type batchResults struct {
+	Results []batchEntryResult `json:"results"`
+}
+
+// newBatchResults converts results
+func newBatchResults(results []batchResult) *batchResults {
+	br := &batchResults{Results: make([]batchEntryResult, len(results))}
+	for i, r := range results {
+		br.Results[i] = batchEntryResult{
+			IP:       r.entry.IP,
+			UserName: r.entry.Username,
+			Type:     r.entry.Type,
+			OK:       r.err == nil,
+			OnlineIP: r.onlineIP,
+			Error:    newResultError(r.err),
+		}
+	}
+	return br
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// writeTemp writes data to file name in a temp dir
+func writeTemp(t *testing.T, name, data string) string {
+	file := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(file, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadBatch(t *testing.T) {
+	entries, err := loadBatch(writeTemp(t, "a.csv", "ip,username,password,type\n# printer\n10.0.0.2,a,1\n10.0.0.3, b, 2, qshd-dx\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []profile{
+		{Name: "a", Username: "a", Password: "1", IP: "10.0.0.2", Type: "qsh-edu"},
+		{Name: "b", Username: "b", Password: "2", IP: "10.0.0.3", Type: "qshd-dx"},
+	}, entries)
+
+	_, err = loadBatch(writeTemp(t, "b.csv", "ip,username,password\n# comment\n10.0.0.2,a,1\n,b,2\n"))
+	assert.ErrorIs(t, err, errBatchIP)
+	var pe *csv.ParseError
+	if assert.ErrorAs(t, err, &pe) {
+		assert.Equal(t, 4, pe.Line)
+	}
+
+	_, err = loadBatch(writeTemp(t, "c.csv", "\n10.0.0.2,a\n"))
+	if assert.ErrorAs(t, err, &pe) {
+		assert.Equal(t, 2, pe.Line)
+		assert.ErrorIs(t, err, csv.ErrFieldCount)
+	}
+
+	_, err = loadBatch(writeTemp(t, "d.json", `[{"username":"a","password":"1"}]`))
+	assert.ErrorIs(t, err, errBatchIP)
+}
+
+func TestRunBatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"` + q.Get("ip") + `"}`
+		case "/cgi-bin/rad_user_info":
+			resp = `{"error":"not_online_error"}`
+		case "/cgi-bin/srun_portal":
+			if strings.HasPrefix(q.Get("username"), "b@") {
+				resp = `{"error":"login_error","error_msg":"E2616: Arrearage users.","client_ip":"` + q.Get("ip") + `"}`
+			} else {
+				resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"` + q.Get("ip") + `","online_ip":"` + q.Get("ip") + `"}`
+			}
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	server := strings.TrimPrefix(srv.URL, "http://")
+	entries := []profile{
+		{Username: "a", Password: "1", IP: "10.0.0.2", Type: "sh-edu", Server: server},
+		{Username: "b", Password: "2", IP: "10.0.0.3", Type: "sh-edu", Server: server},
+	}
+	results := runBatch(entries, 2, func(*portal.Portal) {})
+	assert.NoError(t, results[0].err)
+	assert.Equal(t, "10.0.0.2", results[0].onlineIP)
+	assert.Equal(t, portal.ErrorKindArrears, portal.Classify(results[1].err))
+
+	var sb strings.Builder
+	assert.NoError(t, writeBatchReport(&sb, results))
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.Equal(t, "10.0.0.2,a,sh-edu,success,10.0.0.2,,", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], "10.0.0.3,b,sh-edu,failure,,arrears,"))
+}
@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// progName is the name of the executable in usage and completions
+const progName = "go-nd-portal"
+
+// errUnknownCommand is returned for an unknown command name
+var errUnknownCommand = errors.New("unknown command")
+
+// command of CLI
+type command struct {
+	name string
+	// args in usage line after flags
+	args  string
+	short string
+	// long help, short one if empty
+	long string
+	// flags registers flag groups besides global ones
+	flags func(o *options, fs *flag.FlagSet)
+	run   func(o *options, args []string) error
+	// raw commands print text regardless of -output
+	raw bool
+}
+
+var (
+	// commands in help order
+	commands []*command
+	// legacy parses all flags of flag-only invocation, which runs login by default
+	legacy *command
+)
+
+func init() {
+	commands = []*command{
+		{
+			name:  "login",
+			short: "login and exit, the default command of flag-only invocation",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.userFlags(fs)
+				o.passwordFlags(fs)
+				o.clientFlags(fs)
+				o.preloginFlags(fs)
+				o.onceFlags(fs)
+				o.secretFlags(fs)
+				o.dryRunFlags(fs)
+				o.poolFlags(fs)
+			},
+			run: runLogin,
+		},
+		{
+			name:  "logout",
+			short: "logout the account on client IP",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.userFlags(fs)
+				o.clientFlags(fs)
+			},
+			run: runLogout,
+		},
+		{
+			name:  "status",
+			short: "print online status of client IP, the IP seen by login host if -ip is empty",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.clientFlags(fs)
+			},
+			run: runStatus,
+		},
+		{
+			name:  "daemon",
+			short: "keep the account, -pool or -profiles online",
+			long: "keep the account, -pool or -profiles online by checking every -interval,\n" +
+				"re-authenticating on local client IP changes by -watch and running -sched",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.userFlags(fs)
+				o.passwordFlags(fs)
+				o.clientFlags(fs)
+				o.preloginFlags(fs)
+				fs.BoolVar(&o.force, "force", false, "logout first then login again on the first round")
+				fs.BoolVar(&o.takeover, "takeover", false, "drop another account online on the IP by -force")
+				o.poolFlags(fs)
+				o.daemonFlags(fs, "interval", 5*time.Minute)
+				o.scheduleFlags(fs)
+				o.quotaFlags(fs)
+			},
+			run: runDaemon,
+		},
+		{
+			name:  "schedule",
+			args:  "[next]",
+			short: "print upcoming actions of -sched",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.scheduleFlags(fs)
+			},
+			run: runSchedule,
+		},
+		{
+			name:  "report",
+			short: "print usage report of current billing cycle recorded by -record",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.userFlags(fs)
+				o.quotaFlags(fs)
+			},
+			run: runReport,
+		},
+		{
+			name:  "batch",
+			args:  "<file>",
+			short: "login client IPs in CSV (ip,username,password,type) or JSON file",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.batchFlags(fs)
+			},
+			run: runBatchFile,
+		},
+		{
+			name:  "inspect",
+			args:  "<url>",
+			short: "decode captured srun_portal or get_challenge URL and report fields differing from ours",
+			long: "decode captured srun_portal or get_challenge URL and report fields differing from ours,\n" +
+				"decrypting info with -challenge and recomputing HMAC and chksum with -p",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.passwordFlags(fs)
+				o.secretFlags(fs)
+			},
+			run: runInspect,
+		},
+		{
+			name:  "gateway",
+			args:  "<rules>",
+			short: "login LAN neighbors by JSON rules of mac, cidr or device and logout expired ones",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.gatewayFlags(fs)
+			},
+			run: runGatewayRules,
+		},
+		{
+			name:  "config",
+			args:  "[command]",
+			short: "print effective value of every flag of command, login by default, password redacted",
+			flags: func(o *options, fs *flag.FlagSet) {
+				o.connFlags(fs)
+				o.userFlags(fs)
+				o.passwordFlags(fs)
+				o.clientFlags(fs)
+				o.preloginFlags(fs)
+				o.onceFlags(fs)
+				o.secretFlags(fs)
+				o.dryRunFlags(fs)
+				o.poolFlags(fs)
+				o.daemonFlags(fs, "interval", 5*time.Minute)
+				o.scheduleFlags(fs)
+				o.quotaFlags(fs)
+				o.batchFlags(fs)
+				o.gatewayFlags(fs)
+			},
+			run: runConfig,
+		},
+		{
+			name:  "version",
+			short: "print version",
+			flags: func(o *options, fs *flag.FlagSet) {},
+			run:   runVersion,
+		},
+		{
+			name:  "completion",
+			args:  "<bash | zsh | fish>",
+			short: "print shell completion script",
+			long: "print shell completion script, e.g.\n" +
+				"  " + progName + " completion bash > /etc/bash_completion.d/" + progName + "\n" +
+				"  " + progName + " completion zsh > \"${fpath[1]}/_" + progName + "\"\n" +
+				"  " + progName + " completion fish > ~/.config/fish/completions/" + progName + ".fish",
+			flags: func(o *options, fs *flag.FlagSet) {},
+			run:   runCompletion,
+			raw:   true,
+		},
+		{
+			name:  "help",
+			args:  "[command]",
+			short: "print help of command",
+			flags: func(o *options, fs *flag.FlagSet) {},
+			run:   runHelp,
+			raw:   true,
+		},
+	}
+	legacy = &command{
+		flags: func(o *options, fs *flag.FlagSet) {
+			o.connFlags(fs)
+			o.userFlags(fs)
+			o.passwordFlags(fs)
+			o.clientFlags(fs)
+			o.preloginFlags(fs)
+			o.onceFlags(fs)
+			o.secretFlags(fs)
+			o.dryRunFlags(fs)
+			o.poolFlags(fs)
+			o.daemonFlags(fs, "daemon", 0)
+			o.scheduleFlags(fs)
+			o.quotaFlags(fs)
+			o.batchFlags(fs)
+			o.gatewayFlags(fs)
+		},
+	}
+}
+
+// lookupCommand finds command by name, nil if not found
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// flagSet makes the flag set of c with global flags bound to o
+func (c *command) flagSet(o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(progName+" "+c.name, flag.ContinueOnError)
+	o.globalFlags(fs)
+	c.flags(o, fs)
+	fs.Usage = func() {
+		c.usage(fs.Output())
+	}
+	o.flags = fs
+	return fs
+}
+
+// usage prints help of c to w
+func (c *command) usage(w io.Writer) {
+	if c == legacy {
+		printUsage(w)
+		fmt.Fprintln(w, "\nFlags of flag-only invocation:")
+		fs := flag.NewFlagSet(progName, flag.ContinueOnError)
+		fs.SetOutput(w)
+		o := &options{}
+		o.globalFlags(fs)
+		c.flags(o, fs)
+		fs.PrintDefaults()
+		return
+	}
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, " ", strings.TrimSpace(progName+" "+c.name+" [flags] "+c.args))
+	fmt.Fprintln(w)
+	if c.long != "" {
+		fmt.Fprintln(w, c.long)
+	} else {
+		fmt.Fprintln(w, c.short)
+	}
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	c.flags(&options{}, fs)
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	if n > 0 {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	fs = flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(w)
+	(&options{}).globalFlags(fs)
+	fs.PrintDefaults()
+}
+
+// printUsage prints commands to w
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage:")
+	fmt.Fprintln(w, " ", progName, "<command> [flags] [args]")
+	fmt.Fprintln(w, " ", progName, "[flags]", "\tsame as login, or daemon if any of -daemon, -watch, -sched and -profiles is set")
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.short)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w, "\nRun '"+progName+" help <command>' for flags of a command.")
+}
+
+// runHelp prints help of command in args, or all commands
+func runHelp(_ *options, args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	c := lookupCommand(args[0])
+	if c == nil {
+		return &detailError{err: errUnknownCommand, detail: args[0]}
+	}
+	c.usage(os.Stdout)
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+func TestLookupCommand(t *testing.T) {
+	for _, name := range commandNames() {
+		if assert.NotNil(t, lookupCommand(name), name) {
+			assert.Equal(t, name, lookupCommand(name).name)
+		}
+	}
+	assert.Nil(t, lookupCommand("-n"))
+	assert.Nil(t, lookupCommand(""))
+}
+
+func TestLegacyCommand(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+		rest []string
+	}{
+		{[]string{"-n", "a", "-p", "1"}, "login", []string{}},
+		{[]string{"-n", "a", "-p", "1", "-force"}, "login", []string{}},
+		{[]string{"-daemon", "5m"}, "daemon", []string{}},
+		{[]string{"-watch"}, "daemon", []string{}},
+		{[]string{"-profiles", "p.json"}, "daemon", []string{}},
+		{[]string{"-sched", "login 0 7 * * *"}, "daemon", []string{}},
+		{[]string{"-dry-run", "-daemon", "5m"}, "login", []string{}},
+		{[]string{"-quota", "100", "report"}, "report", []string{}},
+		{[]string{"-j", "2", "batch", "m.csv"}, "batch", []string{"m.csv"}},
+		{[]string{"schedule", "next"}, "schedule", []string{"next"}},
+		{[]string{"-n", "a", "logout"}, "", []string{"logout"}},
+	}
+	for _, tc := range tests {
+		o := &options{}
+		fs := legacy.flagSet(o)
+		fs.SetOutput(io.Discard)
+		err := fs.Parse(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, rest := o.legacyCommand(fs.Args())
+		name := ""
+		if c != nil {
+			name = c.name
+		}
+		assert.Equal(t, tc.want, name, tc.args)
+		assert.Equal(t, tc.rest, rest, tc.args)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, tc := range []struct {
+		shell string
+		write func(io.Writer)
+		flag  string
+	}{
+		{"bash", writeBash, "-"},
+		{"zsh", writeZsh, "-"},
+		{"fish", writeFish, "-o "},
+	} {
+		var sb strings.Builder
+		tc.write(&sb)
+		out := sb.String()
+		for _, name := range commandNames() {
+			assert.Contains(t, out, name, tc.shell)
+		}
+		for _, f := range allCompFlags() {
+			assert.Contains(t, out, tc.flag+f.name, tc.shell)
+		}
+		for _, lt := range portal.LoginTypes {
+			assert.Contains(t, out, string(lt), tc.shell)
+		}
+	}
+
+	// each command completes its own and global flags in bash
+	var sb strings.Builder
+	writeBash(&sb)
+	lines := strings.Split(sb.String(), "\n")
+	for _, c := range commands {
+		var flags []string
+		for _, line := range lines {
+			prefix := c.name + ") flags=\""
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, prefix) {
+				flags = strings.Fields(strings.TrimSuffix(strings.TrimPrefix(line, prefix), "\" ;;"))
+			}
+		}
+		for _, f := range append(compFlags(globalReg), compFlags(c.flags)...) {
+			assert.Contains(t, flags, "-"+f.name, c.name)
+		}
+	}
+
+	assert.ErrorIs(t, runCompletion(&options{}, []string{"tcsh"}), errUnknownShell)
+	assert.ErrorIs(t, runCompletion(&options{}, nil), errMissingArg)
+}
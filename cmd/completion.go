@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+)
+
+// errUnknownShell is returned when completion is asked for an unsupported shell
+var errUnknownShell = errors.New("unknown shell, {bash | zsh | fish}")
+
+// flagValues are candidates to complete flag values with
+var flagValues = map[string][]string{
+	"logfmt": {"text", "json"},
+	"output": {outputText, outputJSON, outputEnv},
+	"smode":  {string(portal.ServerModeFailover), string(portal.ServerModeRace)},
+	"ipby": {
+		string(portal.IPStrategyChallenge), string(portal.IPStrategyRoute),
+		string(portal.IPStrategyInterface), string(portal.IPStrategyCommand),
+	},
+	"mismatch": {
+		string(portal.MismatchPolicyWarn), string(portal.MismatchPolicyStrict), string(portal.MismatchPolicyAdopt),
+	},
+	"drop":     {string(portal.DropRuleOldest), string(portal.DropRuleIP)},
+	"quotaact": {string(quota.ActionAlert), string(quota.ActionLogout), string(quota.ActionRefuse)},
+}
+
+// listFlags take comma separated values of flagValues
+var listFlags = map[string]bool{"t": true, "ipby": true}
+
+// fileFlags take a path
+var fileFlags = map[string]bool{
+	"state": true, "logfile": true, "cafile": true, "har": true, "replay": true,
+	"pool": true, "profiles": true, "batchout": true, "arp": true,
+}
+
+func init() {
+	for _, lt := range portal.LoginTypes {
+		flagValues["t"] = append(flagValues["t"], string(lt))
+	}
+}
+
+// compFlag is a flag to complete
+type compFlag struct {
+	name  string
+	usage string
+	bool  bool
+}
+
+// compFlags lists flags registered by reg in name order
+func compFlags(reg func(o *options, fs *flag.FlagSet)) []compFlag {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	reg(&options{}, fs)
+	var flags []compFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		usage, _, _ := strings.Cut(f.Usage, "\n")
+		bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, compFlag{
+			name:  f.Name,
+			usage: strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(usage), ",")),
+			bool:  ok && bf.IsBoolFlag(),
+		})
+	})
+	return flags
+}
+
+// globalReg registers global flags only
+func globalReg(o *options, fs *flag.FlagSet) {
+	o.globalFlags(fs)
+}
+
+// allCompFlags lists flags of all commands and flag-only invocation without duplicates
+func allCompFlags() []compFlag {
+	seen := make(map[string]bool)
+	var all []compFlag
+	regs := []func(*options, *flag.FlagSet){globalReg, legacy.flags}
+	for _, c := range commands {
+		regs = append(regs, c.flags)
+	}
+	for _, reg := range regs {
+		for _, f := range compFlags(reg) {
+			if !seen[f.name] {
+				seen[f.name] = true
+				all = append(all, f)
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	return all
+}
+
+// commandNames returns names of all commands
+func commandNames() []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.name
+	}
+	return names
+}
+
+// flagNames returns -name of flags
+func flagNames(flags []compFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+	return strings.Join(names, " ")
+}
+
+// runCompletion prints completion script of shell in args
+func runCompletion(_ *options, args []string) error {
+	if len(args) < 1 {
+		return errMissingArg
+	}
+	switch args[0] {
+	case "bash":
+		writeBash(os.Stdout)
+	case "zsh":
+		writeZsh(os.Stdout)
+	case "fish":
+		writeFish(os.Stdout)
+	default:
+		return errUnknownShell
+	}
+	return nil
+}
+
+// writeBash writes bash completion script to w
+func writeBash(w io.Writer) {
+	names := strings.Join(commandNames(), " ")
+	fmt.Fprintf(w, "# bash completion for %s, generated by '%s completion bash'\n", progName, progName)
+	fmt.Fprintln(w, "_go_nd_portal() {")
+	fmt.Fprintln(w, "\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]} cmd='' w flags")
+	fmt.Fprintln(w, "\tfor w in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do")
+	fmt.Fprintf(w, "\t\tcase $w in %s) cmd=$w; break ;; esac\n", strings.Join(commandNames(), "|"))
+	fmt.Fprintln(w, "\tdone")
+	fmt.Fprintln(w, "\tcase $prev in")
+	var files, others []string
+	for _, f := range allCompFlags() {
+		switch {
+		case f.bool:
+		case listFlags[f.name]:
+			fmt.Fprintf(w, "\t-%s) local pre=''; [[ $cur == *,* ]] && pre=${cur%%,*},\n", f.name)
+			fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -P \"$pre\" -W \"%s\" -- \"${cur##*,}\")); return ;;\n", strings.Join(flagValues[f.name], " "))
+		case flagValues[f.name] != nil:
+			fmt.Fprintf(w, "\t-%s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", f.name, strings.Join(flagValues[f.name], " "))
+		case fileFlags[f.name]:
+			files = append(files, "-"+f.name)
+		default:
+			others = append(others, "-"+f.name)
+		}
+	}
+	fmt.Fprintf(w, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", strings.Join(files, "|"))
+	fmt.Fprintf(w, "\t%s) return ;;\n", strings.Join(others, "|"))
+	fmt.Fprintln(w, "\tesac")
+	global := flagNames(compFlags(globalReg))
+	fmt.Fprintln(w, "\tcase $cmd in")
+	for _, c := range commands {
+		fmt.Fprintf(w, "\t%s) flags=\"%s\" ;;\n", c.name, strings.TrimSpace(global+" "+flagNames(compFlags(c.flags))))
+	}
+	fmt.Fprintf(w, "\t*) flags=\"%s %s\" ;;\n", global, flagNames(compFlags(legacy.flags)))
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ $cur == -* ]]; then")
+	fmt.Fprintln(w, "\t\tCOMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase $cmd in")
+	fmt.Fprintf(w, "\t''|help|config) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")) ;;\n", names)
+	fmt.Fprintln(w, "\tcompletion) COMPREPLY=($(compgen -W \"bash zsh fish\" -- \"$cur\")) ;;")
+	fmt.Fprintln(w, "\tschedule) COMPREPLY=($(compgen -W \"next\" -- \"$cur\")) ;;")
+	fmt.Fprintln(w, "\tbatch|gateway) COMPREPLY=($(compgen -f -- \"$cur\")) ;;")
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -F _go_nd_portal %s\n", progName)
+}
+
+// zshQuote quotes s in single quotes for zsh and fish
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeZsh writes zsh completion script to w
+func writeZsh(w io.Writer) {
+	fmt.Fprintf(w, "#compdef %s\n", progName)
+	fmt.Fprintf(w, "# zsh completion for %s, generated by '%s completion zsh'\n\n", progName, progName)
+	fmt.Fprintln(w, "_go_nd_portal() {")
+	fmt.Fprintln(w, "\tlocal cmd w")
+	fmt.Fprintln(w, "\tlocal -a cmds flags")
+	fmt.Fprintln(w, "\tcmds=(")
+	for _, c := range commands {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote(c.name+":"+c.short))
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, "\tfor w in ${words[2,CURRENT-1]}; do")
+	fmt.Fprintf(w, "\t\tcase $w in (%s) cmd=$w; break ;; esac\n", strings.Join(commandNames(), "|"))
+	fmt.Fprintln(w, "\tdone")
+	fmt.Fprintln(w, "\tcase ${words[CURRENT-1]} in")
+	var files, others []string
+	for _, f := range allCompFlags() {
+		switch {
+		case f.bool:
+		case listFlags[f.name]:
+			fmt.Fprintf(w, "\t(-%s) _sequence compadd - %s; return ;;\n", f.name, strings.Join(flagValues[f.name], " "))
+		case flagValues[f.name] != nil:
+			fmt.Fprintf(w, "\t(-%s) compadd - %s; return ;;\n", f.name, strings.Join(flagValues[f.name], " "))
+		case fileFlags[f.name]:
+			files = append(files, "-"+f.name)
+		default:
+			others = append(others, "-"+f.name)
+		}
+	}
+	fmt.Fprintf(w, "\t(%s) _files; return ;;\n", strings.Join(files, "|"))
+	fmt.Fprintf(w, "\t(%s) return ;;\n", strings.Join(others, "|"))
+	fmt.Fprintln(w, "\tesac")
+	zshFlags := func(reg func(*options, *flag.FlagSet)) string {
+		var items []string
+		for _, f := range compFlags(globalReg) {
+			items = append(items, zshQuote("-"+f.name+":"+f.usage))
+		}
+		for _, f := range compFlags(reg) {
+			items = append(items, zshQuote("-"+f.name+":"+f.usage))
+		}
+		return strings.Join(items, "\n\t\t\t")
+	}
+	fmt.Fprintln(w, "\tcase $cmd in")
+	for _, c := range commands {
+		fmt.Fprintf(w, "\t(%s) flags=(\n\t\t\t%s\n\t\t) ;;\n", c.name, zshFlags(c.flags))
+	}
+	fmt.Fprintf(w, "\t(*) flags=(\n\t\t\t%s\n\t\t) ;;\n", zshFlags(legacy.flags))
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ ${words[CURRENT]} == -* ]]; then")
+	fmt.Fprintln(w, "\t\t_describe -t flags flag flags")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase $cmd in")
+	fmt.Fprintln(w, "\t(''|help|config) _describe -t commands command cmds ;;")
+	fmt.Fprintln(w, "\t(completion) compadd - bash zsh fish ;;")
+	fmt.Fprintln(w, "\t(schedule) compadd - next ;;")
+	fmt.Fprintln(w, "\t(batch|gateway) _files ;;")
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "if [[ $funcstack[1] == _%s ]]; then\n", progName)
+	fmt.Fprintln(w, "\t_go_nd_portal \"$@\"")
+	fmt.Fprintln(w, "else")
+	fmt.Fprintf(w, "\tcompdef _go_nd_portal %s\n", progName)
+	fmt.Fprintln(w, "fi")
+}
+
+// writeFish writes fish completion script to w
+func writeFish(w io.Writer) {
+	names := strings.Join(commandNames(), " ")
+	fmt.Fprintf(w, "# fish completion for %s, generated by '%s completion fish'\n", progName, progName)
+	fmt.Fprintf(w, "complete -c %s -f\n", progName)
+	nocmd := fmt.Sprintf("not __fish_seen_subcommand_from %s", names)
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c %s -n '%s' -a %s -d %s\n", progName, nocmd, c.name, zshQuote(c.short))
+	}
+	fishFlags := func(cond string, flags []compFlag) {
+		for _, f := range flags {
+			fmt.Fprintf(w, "complete -c %s", progName)
+			if cond != "" {
+				fmt.Fprintf(w, " -n '%s'", cond)
+			}
+			fmt.Fprintf(w, " -o %s", f.name)
+			switch {
+			case f.bool:
+			case flagValues[f.name] != nil:
+				fmt.Fprintf(w, " -x -a '%s'", strings.Join(flagValues[f.name], " "))
+			case fileFlags[f.name]:
+				fmt.Fprint(w, " -r -F")
+			default:
+				fmt.Fprint(w, " -x")
+			}
+			fmt.Fprintf(w, " -d %s\n", zshQuote(f.usage))
+		}
+	}
+	fishFlags("", compFlags(globalReg))
+	for _, c := range commands {
+		fishFlags("__fish_seen_subcommand_from "+c.name, compFlags(c.flags))
+	}
+	fishFlags(nocmd, compFlags(legacy.flags))
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from help config' -a '%s'\n", progName, names)
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n", progName)
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from schedule' -a next\n", progName)
+	fmt.Fprintf(w, "complete -c %s -n '__fish_seen_subcommand_from batch gateway' -F\n", progName)
+}
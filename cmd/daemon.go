@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/history"
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
+)
+
+// daemon keeps a portal online
+type daemon struct {
+	ptl *portal.Portal
+	// interval of keepalive checks, 0 to disable
+	interval time.Duration
+	// force the first login
+	force bool
+	// takeover drops another account holding the IP on forced login
+	takeover bool
+	// watch local client IP changes
+	watch bool
+	// local is the last locally resolved client IP when watch
+	local string
+	// sched of login and logout, nil for always online
+	sched *schedule.Schedule
+	// offline is true after a scheduled logout
+	offline bool
+	// quota guards traffic usage, nil to disable
+	quota *quota.Guard
+	// alertcmd runs on quota alerts
+	alertcmd string
+	// history records usage samples, nil to disable
+	history *history.Store
+	// pool rotates accounts, d.ptl follows the active one, nil to disable
+	pool *portal.Pool
+	// state dir to save pool cooldowns and quota
+	state string
+	// onRound is called with state and error after each keepalive round if not nil
+	onRound func(state string, err error)
+
+	// clock, after and jitter replace d.ptl.Now, time.NewTimer
+	// and rand.Int63n if not nil
+	clock  func() time.Time
+	after  func(time.Duration) <-chan time.Time
+	jitter func(n int64) int64
+}
+
+// now returns the time of d, the server time by default
+func (d *daemon) now() time.Time {
+	if d.clock != nil {
+		return d.clock()
+	}
+	return d.ptl.Now()
+}
+
+// timer returns the channel firing after dur and the func to stop it
+func (d *daemon) timer(dur time.Duration) (<-chan time.Time, func() bool) {
+	if d.after != nil {
+		return d.after(dur), func() bool { return false }
+	}
+	t := time.NewTimer(dur)
+	return t.C, t.Stop
+}
+
+// run keeps d.ptl online, checking status every interval,
+// re-authenticating on local client IP changes if watch
+// and running scheduled actions.
+// Only the first round is forced, the rest are idempotent.
+func (d *daemon) run() {
+	logrus.Infoln("daemon started, check interval:", d.interval, "watch ip:", d.watch)
+	var changes <-chan struct{}
+	if d.watch {
+		changes = d.ptl.WatchAddrChange(context.Background())
+		d.local, _ = d.ptl.LocalClientIP()
+	}
+	var tick <-chan time.Time
+	if d.interval > 0 {
+		t := time.NewTicker(d.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	d.loop(tick, changes, nil)
+}
+
+// loop runs a keepalive round at start and on each tick, relocating on changes
+// and running scheduled actions in between, until done is closed
+func (d *daemon) loop(tick <-chan time.Time, changes <-chan struct{}, done <-chan struct{}) {
+	if d.quota != nil {
+		loadQuota(d.state, d.ptl.UserName(), d.quota)
+	}
+	if ev, ok := d.sched.Last(d.now()); ok && ev.Action == schedule.ActionLogout {
+		logrus.Infoln("stay offline after scheduled logout at", ev.At)
+		d.offline = true
+	}
+	// pending scheduled event is kept with its jittered fire time until it runs,
+	// so that other wake-ups neither skip it nor redraw the jitter
+	var (
+		pending *schedule.Event
+		fireAt  time.Time
+		due     bool
+	)
+	for {
+		now := d.now()
+		if pending != nil && (due || !now.Before(fireAt)) {
+			d.do(pending.Action)
+			pending, due = nil, false
+			now = d.now()
+		}
+		var (
+			state string
+			err   error
+		)
+		switch {
+		case d.offline:
+			state = "scheduled offline"
+			logrus.Debugln("skip keepalive after scheduled logout")
+		case d.sched.IsQuiet(now):
+			state = "quiet"
+			logrus.Debugln("skip keepalive in quiet window")
+		case d.refuse(now):
+			state = "quota capped"
+			logrus.Debugln("skip keepalive past quota cap")
+		default:
+			state = "online"
+			if d.pool != nil {
+				err = d.keepPool()
+			} else {
+				_, err = login(d.ptl, true, d.force, d.takeover)
+			}
+			if err != nil {
+				state = "error"
+				logrus.Errorln(err)
+			}
+			d.force = false
+			d.poll(now)
+		}
+		if d.onRound != nil {
+			d.onRound(state, err)
+		}
+		if pending == nil {
+			if ev, ok := d.sched.Next(now); ok {
+				pending, fireAt = &ev, ev.At
+				if d.sched.Jitter > 0 {
+					jitter := rand.Int63n
+					if d.jitter != nil {
+						jitter = d.jitter
+					}
+					fireAt = fireAt.Add(time.Duration(jitter(int64(d.sched.Jitter))))
+				}
+				logrus.Debugln("next scheduled", ev.Action, "at", fireAt)
+			}
+		}
+		var fire <-chan time.Time
+		stop := func() bool { return false }
+		if pending != nil {
+			fire, stop = d.timer(fireAt.Sub(d.now()))
+		}
+		select {
+		case <-tick:
+		case <-changes:
+			d.relocate()
+		case <-fire:
+			due = true
+		case <-done:
+			stop()
+			return
+		}
+		stop()
+	}
+}
+
+// poll queries usage for quota guard and history
+func (d *daemon) poll(now time.Time) {
+	if d.quota == nil && d.history == nil {
+		return
+	}
+	st, err := d.ptl.Status()
+	if err != nil {
+		logrus.Warnln("query usage:", err)
+		return
+	}
+	if !st.Online() {
+		return
+	}
+	if !d.ptl.SameUser(st.UserName) {
+		logrus.Debugln("skip usage of another account:", st.UserName)
+		return
+	}
+	logrus.Debugf("traffic usage: %s, online time: %ds, balance: %.2f", formatBytes(float64(st.SumBytes)), st.SumSeconds, st.UserBalance)
+	if d.history != nil {
+		err = d.history.Append(history.Sample{
+			Time:    now,
+			User:    d.ptl.UserName(),
+			Bytes:   st.SumBytes,
+			Seconds: st.SumSeconds,
+			Balance: st.UserBalance,
+		})
+		if err != nil {
+			logrus.Warnln("record usage:", err)
+		}
+	}
+	if d.quota != nil {
+		checkQuota(d.ptl, d.quota, d.alertcmd, now, st)
+		saveQuota(d.state, d.ptl.UserName(), d.quota)
+	}
+}
+
+// refuse reports whether login is refused by quota at now
+func (d *daemon) refuse(now time.Time) bool {
+	if d.quota == nil {
+		return false
+	}
+	d.quota.Roll(now)
+	return d.quota.RefuseLogin()
+}
+
+// do runs scheduled action
+func (d *daemon) do(action schedule.Action) {
+	logrus.Infoln("run scheduled", action)
+	var err error
+	switch action {
+	case schedule.ActionLogin:
+		d.offline = false
+		if d.refuse(d.now()) {
+			logrus.Warnln("scheduled login refused past quota cap")
+			return
+		}
+		_, err = login(d.ptl, true, false, false)
+	case schedule.ActionLogout:
+		d.offline = true
+		err = d.ptl.Logout()
+	case schedule.ActionRelogin:
+		d.offline = false
+		if d.refuse(d.now()) {
+			logrus.Warnln("scheduled relogin refused past quota cap")
+			return
+		}
+		_, err = login(d.ptl, false, true, false)
+	}
+	if err != nil {
+		logrus.Errorln("scheduled", action, "failed:", err)
+	}
+}
+
+// relocate follows changes of the local client IP. A client IP resolved
+// locally is replaced, while one seen by server in challenge, which differs
+// from local addresses behind NAT, is asked from server again.
+// Stale sessions are logged out.
+func (d *daemon) relocate() {
+	local, err := d.ptl.LocalClientIP()
+	if err != nil {
+		logrus.Warnln("resolve local client ip:", err)
+		return
+	}
+	if local == d.local {
+		return
+	}
+	logrus.Infoln("local ip changed from", d.local, "to", local)
+	old := d.ptl.ClientIP()
+	cip := local
+	if old != d.local {
+		d.ptl.SetClientIP("")
+		_, err = d.ptl.GetChallenge()
+		cip = d.ptl.ClientIP()
+		if err != nil || cip == "" {
+			logrus.Warnln("resolve client ip by challenge:", err)
+			cip = old
+		}
+	}
+	d.local = local
+	d.ptl.SetClientIP(old)
+	if cip == old {
+		return
+	}
+	logrus.Infoln("client ip changed from", old, "to", cip)
+	if old != "" {
+		// the old ip may be unreachable now, so just try
+		err = d.ptl.Logout()
+		if err != nil {
+			logrus.Warnln("logout stale ip", old, "failed:", err)
+		}
+	}
+	d.ptl.SetClientIP(cip)
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
+)
+
+func TestRunDaemonNoWakeUp(t *testing.T) {
+	for _, args := range [][]string{
+		{"-interval", "0"},
+		{"-interval", "0", "-sched", "quiet 00:00-06:00"},
+	} {
+		o := &options{}
+		err := lookupCommand("daemon").flagSet(o).Parse(append(args, "-n", "a", "-p", "1", "-state", t.TempDir()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.ErrorIs(t, runDaemon(o, nil), errNoWakeUp, args)
+	}
+}
+
+// daemonHarness drives daemon.loop by a fake clock and timers
+type daemonHarness struct {
+	t       *testing.T
+	d       *daemon
+	tick    chan time.Time
+	changes chan struct{}
+	fire    chan time.Time
+	done    chan struct{}
+	rounds  chan string
+	wg      sync.WaitGroup
+
+	mu sync.Mutex
+	at time.Time
+	// timers are durations of timers started
+	timers []time.Duration
+	// jitters is the number of jitters drawn
+	jitters int
+}
+
+// newDaemonHarness starts the loop of d at at with sched in UTC
+func newDaemonHarness(t *testing.T, d *daemon, at time.Time, sched string) *daemonHarness {
+	h := &daemonHarness{
+		t: t, d: d, at: at,
+		tick:    make(chan time.Time),
+		changes: make(chan struct{}),
+		fire:    make(chan time.Time),
+		done:    make(chan struct{}),
+		rounds:  make(chan string, 1),
+	}
+	if sched != "" {
+		sch, err := schedule.Parse(sched)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sch.Location = time.UTC
+		sch.Jitter = 10 * time.Minute
+		d.sched = sch
+	}
+	d.clock = func() time.Time {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.at
+	}
+	d.after = func(dur time.Duration) <-chan time.Time {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.timers = append(h.timers, dur)
+		return h.fire
+	}
+	d.jitter = func(int64) int64 {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.jitters++
+		return int64(5 * time.Minute)
+	}
+	d.onRound = func(state string, _ error) {
+		h.rounds <- state
+	}
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		d.loop(h.tick, h.changes, h.done)
+	}()
+	t.Cleanup(func() {
+		close(h.done)
+		h.wg.Wait()
+	})
+	return h
+}
+
+// set the clock to at
+func (h *daemonHarness) set(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.at = at
+}
+
+// round waits for the state of next round
+func (h *daemonHarness) round() string {
+	select {
+	case state := <-h.rounds:
+		return state
+	case <-time.After(5 * time.Second):
+		h.t.Fatal("no round")
+		return ""
+	}
+}
+
+// state returns timers and jitters so far
+func (h *daemonHarness) state() ([]time.Duration, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]time.Duration(nil), h.timers...), h.jitters
+}
+
+func TestDaemonPendingJitter(t *testing.T) {
+	f := newFakePortal(t, "")
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	h := newDaemonHarness(t, &daemon{ptl: f.portal(t, "10.0.0.2")}, day.Add(7*time.Hour+59*time.Minute), "login 0 6 * * *; logout 0 8 * * *")
+	assert.Equal(t, "online", h.round())
+	assert.Equal(t, []string{"rad_user_info 10.0.0.2", "get_challenge 10.0.0.2", "srun_portal login 10.0.0.2"}, f.takeCalls())
+
+	// a tick before the jittered fire time keeps the pending event
+	h.set(day.Add(8*time.Hour + time.Minute))
+	h.tick <- time.Time{}
+	assert.Equal(t, "online", h.round())
+	assert.Equal(t, []string{"rad_user_info 10.0.0.2"}, f.takeCalls())
+
+	// a tick past the fire time runs it even if the timer did not fire
+	h.set(day.Add(8*time.Hour + 6*time.Minute))
+	h.tick <- time.Time{}
+	assert.Equal(t, "scheduled offline", h.round())
+	assert.Equal(t, []string{"srun_portal logout 10.0.0.2"}, f.takeCalls())
+
+	timers, jitters := h.state()
+	assert.Equal(t, []time.Duration{6 * time.Minute, 4 * time.Minute}, timers[:2])
+	assert.Equal(t, 2, jitters)
+}
+
+func TestDaemonOfflineAfterScheduledLogout(t *testing.T) {
+	f := newFakePortal(t, "")
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	h := newDaemonHarness(t, &daemon{ptl: f.portal(t, "10.0.0.2")}, day.Add(23*time.Hour+30*time.Minute), "login 0 7 * * *; logout 0 23 * * *")
+	assert.Equal(t, "scheduled offline", h.round())
+	h.tick <- time.Time{}
+	assert.Equal(t, "scheduled offline", h.round())
+	assert.Empty(t, f.takeCalls())
+
+	h.set(day.AddDate(0, 0, 1).Add(7*time.Hour + 5*time.Minute))
+	h.fire <- time.Time{}
+	assert.Equal(t, "online", h.round())
+	assert.Equal(t, []string{
+		"rad_user_info 10.0.0.2", "get_challenge 10.0.0.2", "srun_portal login 10.0.0.2",
+		"rad_user_info 10.0.0.2",
+	}, f.takeCalls())
+}
+
+func TestDaemonSkip(t *testing.T) {
+	at := time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+	f := newFakePortal(t, "")
+	h := newDaemonHarness(t, &daemon{ptl: f.portal(t, "10.0.0.2")}, at, "quiet 00:00-06:00")
+	assert.Equal(t, "quiet", h.round())
+	h.set(at.Add(3 * time.Hour))
+	h.tick <- time.Time{}
+	assert.Equal(t, "online", h.round())
+	assert.Len(t, f.takeCalls(), 3)
+
+	// a restarted daemon past cap does not log in again
+	state := t.TempDir()
+	g := &quota.Guard{Limit: 1, Cap: 100, Action: quota.ActionRefuse, Location: time.UTC}
+	g.Restore(quota.State{Cycle: g.CycleStart(at), Capped: true})
+	saveQuota(state, "a", g)
+	f = newFakePortal(t, "")
+	d := &daemon{ptl: f.portal(t, "10.0.0.2"), state: state, quota: &quota.Guard{Limit: 1, Cap: 100, Action: quota.ActionRefuse, Location: time.UTC}}
+	h = newDaemonHarness(t, d, at, "")
+	assert.Equal(t, "quota capped", h.round())
+	assert.Empty(t, f.takeCalls())
+}
+
+func TestDaemonRelocate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	file := writeTemp(t, "ip", "10.0.0.2\n")
+	f := newFakePortal(t, "")
+	ptl := f.portal(t, "10.0.0.2")
+	ptl.SetClientIPResolver(&portal.ClientIPResolver{
+		Strategies: []portal.IPStrategy{portal.IPStrategyCommand},
+		Command:    "cat " + filepath.ToSlash(file),
+	})
+	h := newDaemonHarness(t, &daemon{ptl: ptl, watch: true, local: "10.0.0.2"}, time.Now(), "")
+	assert.Equal(t, "online", h.round())
+	f.takeCalls()
+
+	err := os.WriteFile(file, []byte("10.0.0.3\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.changes <- struct{}{}
+	assert.Equal(t, "online", h.round())
+	assert.Equal(t, []string{
+		"srun_portal logout 10.0.0.2",
+		"rad_user_info 10.0.0.3", "get_challenge 10.0.0.3", "srun_portal login 10.0.0.3",
+	}, f.takeCalls())
+	assert.Equal(t, "10.0.0.3", ptl.ClientIP())
+
+	// no change of local ip keeps the session
+	h.changes <- struct{}{}
+	assert.Equal(t, "online", h.round())
+	assert.Equal(t, []string{"rad_user_info 10.0.0.3"}, f.takeCalls())
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// dryRunChallenge is used to build login URL when no challenge is given
+const dryRunChallenge = "d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e"
+
+// dryRunResult of login -dry-run
+type dryRunResult struct {
+	ChallengeURL string `json:"challenge_url"`
+	LoginURL     string `json:"login_url"`
+	// curl commands of -curl
+	ChallengeCurl string `json:"challenge_curl,omitempty"`
+	LoginCurl     string `json:"login_curl,omitempty"`
+}
+
+// print writes curl commands if any, or URLs to stdout
+func (r *dryRunResult) print() {
+	if r.ChallengeCurl != "" {
+		fmt.Println(r.ChallengeCurl)
+		fmt.Println(r.LoginCurl)
+		return
+	}
+	fmt.Println(r.ChallengeURL)
+	fmt.Println(r.LoginURL)
+}
+
+// dryRun builds challenge and login URLs of ptl without sending them
+func dryRun(ptl *portal.Portal, challenge string, reveal bool) (*dryRunResult, error) {
+	if ptl.ClientIP() == "" {
+		cip, err := ptl.LocalClientIP()
+		if err != nil {
+			logrus.Warnln("client ip is left empty:", err)
+		} else {
+			logrus.Warnln("client ip is resolved locally as", cip, ", server may see another one")
+			ptl.SetClientIP(cip)
+		}
+	}
+	if challenge == "" {
+		logrus.Warnln("no challenge is given, login URL is built from a fixed test value")
+		challenge = dryRunChallenge
+	}
+	cu, err := ptl.ChallengeURL()
+	if err != nil {
+		return nil, err
+	}
+	lu, err := ptl.LoginURL(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if !reveal {
+		cu, lu = portal.Redact(cu), portal.Redact(lu)
+	}
+	return &dryRunResult{ChallengeURL: cu, LoginURL: lu}, nil
+}
+
+// curlCommand returns the equivalent curl command line of GET u
+func curlCommand(u string, args []string) string {
+	var b strings.Builder
+	b.WriteString("curl -sS")
+	for _, a := range args {
+		b.WriteByte(' ')
+		b.WriteString(shellQuote(a))
+	}
+	b.WriteString(" -A ")
+	b.WriteString(shellQuote(portal.PortalHeaderUA))
+	b.WriteByte(' ')
+	b.WriteString(shellQuote(u))
+	return b.String()
+}
+
+// shellQuote quotes s for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
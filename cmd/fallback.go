@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// fallbackFile in state dir
+const fallbackFile = "fallback.json"
+
+// fallbackState is the persisted part of portal.Fallback
+type fallbackState struct {
+	Last portal.LoginType                   `json:"last"`
+	RTTs map[portal.LoginType]time.Duration `json:"rtts,omitempty"`
+}
+
+// loadFallback reads last worked login type from state dir, empty if not exist
+func loadFallback(dir string) (st fallbackState) {
+	loadState(dir, fallbackFile, &st)
+	return
+}
+
+// saveFallback writes last worked login type of f into state dir if changed
+func saveFallback(dir string, f *portal.Fallback) {
+	old := loadFallback(dir)
+	if old.Last == f.Last && len(f.RTTs) == 0 {
+		return
+	}
+	st := fallbackState{Last: f.Last, RTTs: f.RTTs}
+	if len(st.RTTs) == 0 {
+		st.RTTs = old.RTTs
+	}
+	saveState(dir, fallbackFile, &st)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/gateway"
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// runGateway logs in LAN neighbors by rules and logs them out when they expire
+func runGateway(rules []gateway.Rule, arp string, poll time.Duration, misses int, server string, configure func(*portal.Portal)) {
+	tr := gateway.Tracker{Misses: misses}
+	// sessions of logged in neighbors by IP
+	sessions := make(map[string]*portal.Portal)
+	// pending neighbors to login by IP, failed ones are retried next poll
+	pending := make(map[string]gateway.Neighbor)
+	logrus.Infoln("gateway started, neighbor table:", arp, "poll interval:", poll)
+	for {
+		ns, err := gateway.ReadARP(arp)
+		if err != nil {
+			logrus.Errorln("read neighbor table:", err)
+		} else {
+			added, removed := tr.Update(ns)
+			for _, n := range removed {
+				delete(pending, n.IP)
+				ptl, ok := sessions[n.IP]
+				if !ok {
+					continue
+				}
+				delete(sessions, n.IP)
+				logrus.Infoln("neighbor", n.IP, n.MAC, "expired, logout")
+				err = ptl.Logout()
+				if err != nil {
+					logrus.Warnln("logout", n.IP, "failed:", err)
+				}
+			}
+			for _, n := range added {
+				pending[n.IP] = n
+			}
+			for ip, n := range pending {
+				r := gateway.Find(rules, n)
+				if r == nil {
+					logrus.Debugln("neighbor", n.IP, n.MAC, "on", n.Device, "matches no rule")
+					delete(pending, ip)
+					continue
+				}
+				typ := r.Type
+				if typ == "" {
+					typ = string(portal.LoginTypeQshEdu)
+				}
+				ptl, err := portal.NewPortal(r.Username, r.Password, server, n.IP, portal.LoginType(typ))
+				if err != nil {
+					logrus.Errorln("neighbor", n.IP, "rule invalid:", err)
+					delete(pending, ip)
+					continue
+				}
+				configure(ptl)
+				logrus.Infoln("neighbor", n.IP, n.MAC, "on", n.Device, "login as", r.Username)
+				_, err = login(ptl, true, false, false)
+				if err != nil {
+					logrus.Warnln("login", n.IP, "failed:", err)
+					continue
+				}
+				delete(pending, ip)
+				sessions[ip] = ptl
+			}
+		}
+		time.Sleep(poll)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// inspectField is a decoded field of captured URL
+type inspectField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// inspectDiff is a field differing from what portal generates
+type inspectDiff struct {
+	Field    string `json:"field"`
+	Captured string `json:"captured"`
+	Expected string `json:"expected"`
+}
+
+// inspectResult of inspect command, secrets hidden unless revealed
+type inspectResult struct {
+	CGI    string         `json:"cgi"`
+	Fields []inspectField `json:"fields"`
+	Diffs  []inspectDiff  `json:"diffs"`
+}
+
+// newInspectResult collects fields of captured URL and those differing from what portal generates
+func newInspectResult(ins *portal.Inspection, reveal bool) *inspectResult {
+	hide := func(s string) string {
+		if reveal || s == "" {
+			return s
+		}
+		return "***"
+	}
+	r := &inspectResult{CGI: ins.CGI, Diffs: []inspectDiff{}}
+	add := func(name, value string) {
+		r.Fields = append(r.Fields, inspectField{Name: name, Value: value})
+	}
+	if c := ins.Challenge; c != nil {
+		add("callback", c.Callback)
+		add("username", c.Username)
+		add("ip", c.IP)
+		add("_", strconv.FormatInt(c.Timestamp, 10))
+	}
+	if p := ins.Portal; p != nil {
+		for _, kv := range [][2]string{
+			{"callback", p.Callback}, {"action", p.Action}, {"username", p.Username},
+			{"password", hide(p.EncryptedPassword)}, {"ac_id", p.AcID}, {"ip", p.IP},
+			{"chksum", hide(p.Checksum)}, {"info", hide(p.EncodedUserInfo)}, {"n", p.ConstantN},
+			{"type", p.ConstantType}, {"os", p.OS}, {"name", p.Platform}, {"double_stack", p.DoubleStack},
+		} {
+			add(kv[0], kv[1])
+		}
+		add("_", strconv.FormatInt(p.Timestamp, 10))
+	}
+	if ui := ins.UserInfo; ui != nil {
+		add("info.username", ui.Username)
+		add("info.password", hide(ui.Password))
+		add("info.ip", ui.IP)
+		add("info.acid", ui.AcID)
+		add("info.enc_ver", ui.EncVer)
+	}
+	for _, d := range ins.Diffs {
+		captured, expected := d.Captured, d.Expected
+		switch d.Field {
+		case "password", "info", "chksum", "info.password":
+			captured, expected = hide(captured), hide(expected)
+		}
+		r.Diffs = append(r.Diffs, inspectDiff{Field: d.Field, Captured: captured, Expected: expected})
+	}
+	return r
+}
+
+// print writes fields and diffs as tables to stdout
+func (r *inspectResult) print() {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "cgi\t"+r.CGI)
+	for _, f := range r.Fields {
+		fmt.Fprintln(tw, f.Name+"\t"+f.Value)
+	}
+	_ = tw.Flush()
+	fmt.Println()
+	if len(r.Diffs) == 0 {
+		fmt.Println("all checked fields match")
+		return
+	}
+	tw = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tCAPTURED\tPORTAL")
+	for _, d := range r.Diffs {
+		fmt.Fprintln(tw, d.Field+"\t"+d.Captured+"\t"+d.Expected)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// errIllegalLogFormat is returned when -logfmt is neither text nor json
+var errIllegalLogFormat = errors.New("illegal log format")
+
+// rotateFile appends to path and rotates it to path.1 ... path.keep past size bytes
+type rotateFile struct {
+	path string
+	size int64
+	keep int
+
+	mu sync.Mutex
+	f  *os.File
+	n  int64
+}
+
+// openRotateFile opens path for appending
+func openRotateFile(path string, size int64, keep int) (*rotateFile, error) {
+	r := &rotateFile{path: path, size: size, keep: keep}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens r.path and takes its size
+func (r *rotateFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f, r.n = f, info.Size()
+	return nil
+}
+
+// Write implements io.Writer, rotating before b would exceed size
+func (r *rotateFile) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.n > 0 && r.n+int64(len(b)) > r.size {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(b)
+	r.n += int64(n)
+	return n, err
+}
+
+// rotate shifts path.i to path.i+1, dropping path.keep, and reopens path
+func (r *rotateFile) rotate() error {
+	_ = r.f.Close()
+	for i := r.keep - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	var err error
+	if r.keep > 0 {
+		err = os.Rename(r.path, r.path+".1")
+	} else {
+		err = os.Remove(r.path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+func init() {
+	logrus.AddHook(redactHook{})
+}
+
+// redactHook masks secrets in messages and fields of all logs,
+// as errors of login requests carry password hash, info and chksum in URL
+type redactHook struct{}
+
+// Levels implements logrus.Hook
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (redactHook) Fire(e *logrus.Entry) error {
+	e.Message = portal.Redact(e.Message)
+	for k, v := range e.Data {
+		switch v.(type) {
+		case string, error, fmt.Stringer:
+			e.Data[k] = portal.Redact(fmt.Sprint(v))
+		}
+	}
+	return nil
+}
+
+// setupLog applies -logfmt and destination of logs
+func setupLog(format, file string, size int64, keep int, sys bool) error {
+	switch format {
+	case "text":
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return errIllegalLogFormat
+	}
+	var out io.Writer = os.Stderr
+	if file != "" {
+		f, err := openRotateFile(file, size, keep)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+	if sys {
+		err := addSyslogHook()
+		if err != nil {
+			return err
+		}
+		if file == "" {
+			out = io.Discard
+		}
+	}
+	logrus.SetOutput(out)
+	return nil
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFile returns content of file, "-" if not exist
+func readFile(t *testing.T, file string) string {
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "-"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "portal.log")
+	r, err := openRotateFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"line1\n", "line2\n", "line3\n", "line4\n"} {
+		_, err = r.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = r.f.Close()
+	assert.Equal(t, []string{"line4\n", "line3\n", "line2\n", "-"},
+		[]string{readFile(t, path), readFile(t, path+".1"), readFile(t, path+".2"), readFile(t, path+".3")})
+
+	// size of existing file counts after reopening
+	r, err = openRotateFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Write([]byte("line5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.f.Close()
+	assert.Equal(t, []string{"line5\n", "line4\n", "line3\n"},
+		[]string{readFile(t, path), readFile(t, path+".1"), readFile(t, path+".2")})
+
+	// a single write larger than size is kept whole
+	path = filepath.Join(t.TempDir(), "portal.log")
+	r, err = openRotateFile(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"line1\n", "line2\n"} {
+		_, err = r.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = r.f.Close()
+	assert.Equal(t, []string{"line2\n", "-"}, []string{readFile(t, path), readFile(t, path+".1")})
+}
+
+func TestRedactHook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "portal.log")
+	r, err := openRotateFile(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.f.Close()
+	u := "http://10.253.0.237/cgi-bin/srun_portal?password={MD5}c0433&info={SRBX1}abc&chksum=def"
+	for _, f := range []logrus.Formatter{&logrus.TextFormatter{}, &logrus.JSONFormatter{}} {
+		l := logrus.New()
+		l.AddHook(redactHook{})
+		l.SetOutput(r)
+		l.SetFormatter(f)
+		l.WithField("err", &url.Error{Op: "Get", URL: u, Err: errors.New("EOF")}).
+			WithField("url", u).
+			Errorln("login failed:", u)
+	}
+	out := readFile(t, path)
+	for _, secret := range []string{"c0433", "SRBX1", "def"} {
+		assert.NotContains(t, out, secret)
+	}
+	assert.Contains(t, out, "password=***")
+	assert.Contains(t, out, "EOF")
+}
+
+func TestSetupLog(t *testing.T) {
+	assert.ErrorIs(t, setupLog("xml", "", 0, 0, false), errIllegalLogFormat)
+
+	out, formatter := logrus.StandardLogger().Out, logrus.StandardLogger().Formatter
+	defer func() {
+		logrus.SetOutput(out)
+		logrus.SetFormatter(formatter)
+	}()
+	path := filepath.Join(t.TempDir(), "portal.log")
+	err := setupLog("json", path, 1<<20, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logrus.WithField("url", "srun_portal?password={MD5}c0433").Warnln("login failed")
+	_ = logrus.StandardLogger().Out.(*rotateFile).f.Close()
+	data := readFile(t, path)
+	assert.Contains(t, data, `"level":"warning"`)
+	assert.NotContains(t, data, "c0433")
+}
@@ -2,18 +2,25 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"net/netip"
 	"os"
 	"runtime"
+	"strings"
+	"time"
 
 	"golang.org/x/term"
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/fumiama/go-nd-portal/gateway"
 	"github.com/fumiama/go-nd-portal/helper"
+	"github.com/fumiama/go-nd-portal/history"
 	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
 )
 
 func line() int {
@@ -26,83 +33,585 @@ func line() int {
 
 const query = "query"
 
+var (
+	// errWatchWithIP is returned when -watch is set with fixed -ip
+	errWatchWithIP = errors.New("-watch cannot be used with -ip")
+	// errNoWakeUp is returned when a daemon has nothing to wake it up
+	errNoWakeUp = errors.New("daemon needs -interval, -watch or a scheduled action")
+	// errMissingArg is returned when a command lacks its positional argument
+	errMissingArg = errors.New("missing argument, see help of the command")
+	// errIllegalFlag wraps flag parsing errors
+	errIllegalFlag = errors.New("illegal flag")
+)
+
+// detailError adds detail to a sentinel err, which it unwraps to
+type detailError struct {
+	err    error
+	detail string
+}
+
+// Error implements the error interface for detailError
+func (e *detailError) Error() string {
+	return e.err.Error() + ": " + e.detail
+}
+
+// Unwrap returns the sentinel error
+func (e *detailError) Unwrap() error {
+	return e.err
+}
+
 // Main cmd program
 func Main() {
-	ip := flag.String("ip", "", "client IP, auto get from login host when empty")
-	n := flag.String("n", query, "username")
-	p := flag.String("p", query, "password")
-	h := flag.Bool("h", false, "display this help")
-	w := flag.Bool("w", false, "only display warn-or-higher-level log")
-	d := flag.Bool("d", false, "display debug-level log")
-	s := flag.String("s", "", "login host, auto select when empty")
-	t := flag.String("t", "qsh-edu", "login type, \n {qsh-edu | qsh-dx | qshd-dx | qshd-cmcc | sh-edu | sh-dx | sh-cmcc}")
-	flag.Parse()
-	if *h {
-		fmt.Println("Usage:")
-		flag.PrintDefaults()
+	args := os.Args[1:]
+	c := legacy
+	if len(args) > 0 {
+		if found := lookupCommand(args[0]); found != nil {
+			c, args = found, args[1:]
+		}
+	}
+	o := &options{}
+	fs := c.flagSet(o)
+	name := c.name
+	if c == legacy {
+		name = "login"
+	}
+	err := fs.Parse(args)
+	if err == flag.ErrHelp {
 		os.Exit(0)
 	}
-	if *d {
-		logrus.SetLevel(logrus.DebugLevel)
-	} else if *w {
-		logrus.SetLevel(logrus.WarnLevel)
+	if err != nil {
+		o.output = outputArg(args)
+		_ = o.writeResult(os.Stdout, name, &detailError{err: errIllegalFlag, detail: err.Error()})
+		os.Exit(2)
+	}
+	args = fs.Args()
+	if c == legacy {
+		c, args = o.legacyCommand(args)
+		if c == nil {
+			o.fail(name, &detailError{err: errUnknownCommand, detail: args[0]}, line())
+		}
+	}
+	err = o.setup()
+	if err != nil {
+		o.fail(c.name, err, line())
+	}
+	err = c.run(o, args)
+	if o.srvs != nil {
+		saveServers(o.state, o.srvs)
+	}
+	if c.raw {
+		o.output = outputText
+	}
+	if err != nil {
+		o.fail(c.name, err, line())
+	}
+	_ = o.writeResult(os.Stdout, c.name, nil)
+}
+
+// fail logs err, writes it as result document and exits with code
+func (o *options) fail(name string, err error, code int) {
+	logrus.Errorln(portal.Redact(err.Error()))
+	_ = o.writeResult(os.Stdout, name, err)
+	os.Exit(code)
+}
+
+// legacyCommand picks the command of flag-only invocation like before subcommands,
+// where command names could only follow the flags, nil if args[0] is unknown
+func (o *options) legacyCommand(args []string) (*command, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "schedule", "report", "batch", "inspect", "gateway":
+			return lookupCommand(args[0]), args[1:]
+		default:
+			return nil, args
+		}
+	}
+	if !o.dry && (o.profiles != "" || o.interval > 0 || o.watch || o.sched != "") {
+		return lookupCommand("daemon"), args
+	}
+	return lookupCommand("login"), args
+}
+
+// loginResult of login command
+type loginResult struct {
+	UserName string `json:"username"`
+	Type     string `json:"type"`
+	Server   string `json:"server"`
+	ClientIP string `json:"client_ip"`
+	OnlineIP string `json:"online_ip"`
+	// AlreadyOnline is true if login is skipped by -idem
+	AlreadyOnline bool `json:"already_online"`
+}
+
+// newLoginResult of ptl
+func newLoginResult(ptl *portal.Portal, online bool) *loginResult {
+	return &loginResult{
+		UserName:      ptl.UserName(),
+		Type:          string(ptl.LoginType()),
+		Server:        ptl.Server(),
+		ClientIP:      ptl.ClientIP(),
+		OnlineIP:      ptl.OnlineIP(),
+		AlreadyOnline: online,
+	}
+}
+
+// runLogin logs in once, by -pool if set
+func runLogin(o *options, _ []string) error {
+	err := o.setupPortal()
+	if err != nil {
+		return err
+	}
+	if o.pool != "" {
+		d, err := o.poolDaemon()
+		if err != nil {
+			return err
+		}
+		err = d.keepPool()
+		o.setResult(newLoginResult(d.ptl, false), nil)
+		if err != nil {
+			return err
+		}
+		logrus.Infoln("success")
+		return nil
+	}
+	ptl, fb, err := o.portal()
+	if err != nil {
+		return err
+	}
+	defer ptl.Clear()
+	if o.dry {
+		r, err := dryRun(ptl, o.challenge, o.reveal)
+		if err != nil {
+			return err
+		}
+		if o.curl {
+			var curlArgs []string
+			if o.cafile != "" {
+				curlArgs = append(curlArgs, "--cacert", o.cafile)
+			}
+			if o.insecure {
+				curlArgs = append(curlArgs, "-k")
+			}
+			r.ChallengeCurl = curlCommand(r.ChallengeURL, curlArgs)
+			r.LoginCurl = curlCommand(r.LoginURL, curlArgs)
+		}
+		o.setResult(r, r.print)
+		return nil
+	}
+	err = o.prelogin(ptl, fb)
+	if err != nil {
+		return err
+	}
+	online, err := login(ptl, o.idem, o.force, o.takeover)
+	if fb != nil {
+		saveFallback(o.state, fb)
+	}
+	o.setResult(newLoginResult(ptl, online), nil)
+	return err
+}
+
+// runDaemon keeps the account, -pool or -profiles online
+func runDaemon(o *options, _ []string) error {
+	err := o.setupPortal()
+	if err != nil {
+		return err
+	}
+	sch, err := o.schedule()
+	if err != nil {
+		return err
+	}
+	guard, err := o.guard()
+	if err != nil {
+		return err
+	}
+	store, err := o.history()
+	if err != nil {
+		return err
+	}
+	if o.profiles != "" {
+		pfs, err := loadProfiles(o.profiles)
+		if err != nil {
+			return err
+		}
+		sv := &supervisor{}
+		if o.output != outputText {
+			// keep stdout for the result document
+			sv.out = os.Stderr
+		}
+		sv.run(pfs, o.profileDaemon(sch, guard, store), o.interval)
+		return nil
+	}
+	if o.interval <= 0 && !o.watch && (sch == nil || len(sch.Rules) == 0) {
+		return errNoWakeUp
 	}
-	if *ip != "" {
-		// just validate IP here,
-		// dont convert to net.IP because we need only its string later
-		_, err := netip.ParseAddr(*ip)
+	var d *daemon
+	if o.pool != "" {
+		d, err = o.poolDaemon()
+		if err != nil {
+			return err
+		}
+	} else {
+		if o.watch && o.ip != "" {
+			return errWatchWithIP
+		}
+		ptl, fb, err := o.portal()
 		if err != nil {
-			logrus.Errorln(err)
-			os.Exit(line())
+			return err
+		}
+		err = o.prelogin(ptl, fb)
+		if err != nil {
+			return err
+		}
+		d = &daemon{ptl: ptl, force: o.force, takeover: o.takeover}
+		d.onRound = func(string, error) {
+			if fb != nil {
+				saveFallback(o.state, fb)
+			}
+			if o.srvs != nil {
+				saveServers(o.state, o.srvs)
+			}
 		}
 	}
-	if *n == query {
-		fmt.Printf("username: ")
-		_, err := fmt.Scanln(n)
+	d.interval = o.interval
+	d.watch = o.watch
+	d.sched = sch
+	d.quota = guard
+	d.alertcmd = o.quotaCmd
+	d.history = store
+	d.state = o.state
+	d.run()
+	return nil
+}
+
+// portal makes the portal of -n, -p and -t, prompting for them if not given,
+// with fallback chain if -t has more than one type
+func (o *options) portal() (*portal.Portal, *portal.Fallback, error) {
+	if o.name == query {
+		fmt.Fprint(os.Stderr, "username: ")
+		_, err := fmt.Scanln(&o.name)
 		if err != nil {
-			logrus.Errorln(err)
-			os.Exit(line())
+			return nil, nil, err
 		}
 	}
-	if *p == query {
-		fmt.Printf("password: ")
+	var pswdBuf []byte
+	if o.pswd == query {
+		fmt.Fprint(os.Stderr, "password: ")
 		data, err := term.ReadPassword(int(os.Stdin.Fd()))
 		if err != nil {
-			logrus.Errorln(err)
-			os.Exit(line())
+			return nil, nil, err
 		}
-		*p = helper.BytesToString(data)
-		fmt.Println()
+		o.pswd = helper.BytesToString(data)
+		fmt.Fprintln(os.Stderr)
+		pswdBuf = data
 	}
-	if *s != "" {
-		// just validate IP here,
-		// dont convert to net.IP because we need only its string later
-		_, err := netip.ParseAddr(*s)
+	types, err := portal.ParseLoginTypes(o.types)
+	if err != nil {
+		return nil, nil, err
+	}
+	ptl, err := portal.NewPortal(o.name, o.pswd, o.server, o.ip, types[0])
+	// password read from terminal is copied into portal, dont keep it in memory
+	portal.Secret(pswdBuf).Clear()
+	if err != nil {
+		return nil, nil, err
+	}
+	o.configure(ptl)
+	if len(types) < 2 {
+		return ptl, nil, nil
+	}
+	fb := &portal.Fallback{Types: types, Last: loadFallback(o.state).Last, Probe: o.probe}
+	err = ptl.SetFallback(fb)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ptl, fb, nil
+}
+
+// prelogin waits for local client IP by -wait and probes login types by -probenow
+func (o *options) prelogin(ptl *portal.Portal, fb *portal.Fallback) error {
+	if o.wait > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), o.wait)
+		_, err := ptl.WaitLocalClientIP(ctx)
+		cancel()
 		if err != nil {
-			logrus.Errorln(err)
-			os.Exit(line())
+			return err
 		}
 	}
-	// n : username
-	// p: password
-	// ip : public ip
-	// *t : login type
-	ptl, err := portal.NewPortal(*n, *p, *s, *ip, portal.LoginType(*t))
+	if o.probenow {
+		if fb == nil || fb.Probe == "" {
+			logrus.Warnln("-probenow needs -probe and more than one type in -t")
+			return nil
+		}
+		err := ptl.ProbeFallback()
+		if err != nil {
+			logrus.Warnln("probe:", err)
+		}
+		saveFallback(o.state, fb)
+	}
+	return nil
+}
+
+// poolDaemon makes the daemon of -pool following its active account
+func (o *options) poolDaemon() (*daemon, error) {
+	pfs, err := loadProfiles(o.pool)
+	if err != nil {
+		return nil, err
+	}
+	pl := &portal.Pool{
+		Log: o.logger,
+		New: func(c portal.Credential) (*portal.Portal, error) {
+			ptl, err := portal.NewPortal(c.Username, c.Password, o.server, o.ip, c.Type)
+			if err != nil {
+				return nil, err
+			}
+			o.configure(ptl)
+			return ptl, nil
+		},
+		ResetAt: func(kind portal.ErrorKind, now time.Time) time.Time {
+			switch kind {
+			case portal.ErrorKindArrears, portal.ErrorKindExhausted:
+				return (&quota.Guard{CycleDay: o.cycleDay, Location: o.loc}).CycleEnd(now)
+			default:
+				return now.Add(o.poolcool)
+			}
+		},
+		Cooldowns: loadCooldowns(o.state),
+	}
+	for _, pf := range pfs {
+		pl.Credentials = append(pl.Credentials, portal.Credential{
+			Username: pf.Username,
+			Password: pf.Password,
+			Type:     portal.LoginType(pf.Type),
+		})
+	}
+	ptl, err := pl.Current()
+	if err != nil {
+		return nil, err
+	}
+	return &daemon{ptl: ptl, pool: pl, state: o.state}, nil
+}
+
+// runSchedule prints upcoming actions of -sched
+func runSchedule(o *options, _ []string) error {
+	sch, err := o.schedule()
+	if err != nil {
+		return err
+	}
+	now := o.now()
+	r := &scheduleResult{Events: []scheduleEvent{}, Quiet: []string{}}
+	if sch != nil {
+		for _, ev := range sch.Upcoming(now, 10) {
+			r.Events = append(r.Events, scheduleEvent{At: ev.At, Action: string(ev.Action)})
+		}
+		r.JitterSeconds = int64(sch.Jitter / time.Second)
+		for _, w := range sch.Quiet {
+			r.Quiet = append(r.Quiet, fmt.Sprintf("%02d:%02d-%02d:%02d", w.From/60, w.From%60, w.To/60, w.To%60))
+		}
+	}
+	o.setResult(r, func() {
+		printSchedule(sch, now)
+	})
+	return nil
+}
+
+// scheduleResult of schedule command
+type scheduleResult struct {
+	Events        []scheduleEvent `json:"events"`
+	JitterSeconds int64           `json:"jitter_seconds"`
+	Quiet         []string        `json:"quiet"`
+}
+
+// scheduleEvent is an upcoming action
+type scheduleEvent struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+}
+
+// runReport prints usage report of current billing cycle
+func runReport(o *options, _ []string) error {
+	store, err := history.Open(o.state)
+	if err != nil {
+		return err
+	}
+	g, err := o.guard()
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		g = &quota.Guard{CycleDay: o.cycleDay, Location: o.loc}
+	}
+	user := ""
+	if o.name != query {
+		user = o.name
+	}
+	r, err := newUsageReport(store, user, g, o.now())
+	if err != nil {
+		return err
+	}
+	o.setResult(r, r.print)
+	return nil
+}
+
+// runBatchFile logs in entries of file and writes the report
+func runBatchFile(o *options, args []string) error {
+	if len(args) < 1 {
+		return errMissingArg
+	}
+	err := o.setupPortal()
+	if err != nil {
+		return err
+	}
+	entries, err := loadBatch(args[0])
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if entries[i].Server == "" {
+			entries[i].Server = o.server
+		}
+	}
+	results := runBatch(entries, o.jobs, o.configure)
+	o.setResult(newBatchResults(results), nil)
+	if o.batchout == "" {
+		if o.output != outputText {
+			return nil
+		}
+		return writeBatchReport(os.Stdout, results)
+	}
+	out, err := os.Create(o.batchout)
 	if err != nil {
-		logrus.Errorln(err)
-		os.Exit(line())
+		return err
+	}
+	defer out.Close()
+	return writeBatchReport(out, results)
+}
+
+// runInspect decodes captured portal URL
+func runInspect(o *options, args []string) error {
+	if len(args) < 1 {
+		return errMissingArg
+	}
+	pswd := o.pswd
+	if pswd == query {
+		pswd = ""
+	}
+	ins, err := portal.Inspect(args[0], o.challenge, pswd)
+	if err != nil {
+		return err
+	}
+	r := newInspectResult(ins, o.reveal)
+	o.setResult(r, r.print)
+	return nil
+}
+
+// runGatewayRules logs in LAN neighbors by rules file
+func runGatewayRules(o *options, args []string) error {
+	if len(args) < 1 {
+		return errMissingArg
+	}
+	err := o.setupPortal()
+	if err != nil {
+		return err
+	}
+	rules, err := gateway.LoadRules(args[0])
+	if err != nil {
+		return err
+	}
+	runGateway(rules, o.arp, o.arppoll, o.arpmiss, o.server, o.configure)
+	return nil
+}
+
+// printSchedule prints upcoming actions of sch after now
+func printSchedule(sch *schedule.Schedule, now time.Time) {
+	if sch == nil {
+		fmt.Println("no schedule, set it by -sched")
+		return
+	}
+	for _, ev := range sch.Upcoming(now, 10) {
+		fmt.Println(ev.At.Format("2006-01-02 15:04 MST Mon"), ev.Action)
+	}
+	if sch.Jitter > 0 {
+		fmt.Println("each action is delayed randomly up to", sch.Jitter)
+	}
+	for _, w := range sch.Quiet {
+		fmt.Printf("quiet %02d:%02d-%02d:%02d\n", w.From/60, w.From%60, w.To/60, w.To%60)
+	}
+}
+
+// checkServer validates login host
+func checkServer(s string) error {
+	// just validate it here,
+	// we need only its string later
+	_, err := portal.ParseServer(s)
+	return err
+}
+
+// splitList splits comma separated list, dropping empty items
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// login runs challenge and login, skipping them if idem and already online,
+// and reports whether it is skipped.
+// If force, it logs out first by forceLogout.
+func login(ptl *portal.Portal, idem, force, takeover bool) (bool, error) {
+	if force {
+		err := forceLogout(ptl, takeover)
+		if err != nil {
+			return false, err
+		}
+	} else if idem {
+		online, err := ptl.IsOnline()
+		if err != nil {
+			return false, err
+		}
+		if online {
+			logrus.Infoln("already online")
+			return true, nil
+		}
 	}
 	challenge, err := ptl.GetChallenge()
 	if err != nil {
-		logrus.Errorln(err)
-		os.Exit(line())
+		return false, err
 	}
 	// input:
 	// challenge
 	err = ptl.Login(challenge)
 	if err != nil {
-		logrus.Errorln(err)
-		os.Exit(line())
+		return false, err
 	}
 	logrus.Infoln("success")
+	return false, nil
+}
+
+// forceLogout logs ptl out of the IP it is online on.
+// If another account holds the IP, it is dropped if takeover,
+// or an *portal.OccupiedError is returned.
+func forceLogout(ptl *portal.Portal, takeover bool) error {
+	online, err := ptl.IsOnline()
+	var oe *portal.OccupiedError
+	if errors.As(err, &oe) {
+		if !takeover {
+			return err
+		}
+		logrus.Warnln("take over", oe.IP, "from", oe.UserName)
+		return ptl.DropUser(oe.IP, oe.UserName)
+	}
+	if err != nil || !online {
+		return err
+	}
+	if ptl.ClientIP() == "" {
+		ptl.SetClientIP(ptl.OnlineIP())
+	}
+	err = ptl.Logout()
+	if err != nil {
+		logrus.Warnln("logout before login:", err)
+	}
+	return nil
 }
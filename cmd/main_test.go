@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/history"
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// fakePortal is a portal server with one session, recording calls
+type fakePortal struct {
+	*httptest.Server
+	mu sync.Mutex
+	// holder and ip of the session, offline if holder is empty
+	holder, ip string
+	calls      []string
+}
+
+// newFakePortal starts a fake portal where holder is online on 10.0.0.2 if not empty
+func newFakePortal(t *testing.T, holder string) *fakePortal {
+	f := &fakePortal{holder: holder, ip: "10.0.0.2"}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// serve replies like srun portal, taking 10.0.0.2 as the IP of requests without one
+func (f *fakePortal) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	cgi := strings.TrimPrefix(r.URL.Path, "/cgi-bin/")
+	ip := q.Get("ip")
+	if ip == "" {
+		ip = "10.0.0.2"
+	}
+	call := []string{cgi}
+	var resp string
+	switch cgi {
+	case "get_challenge":
+		resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"` + ip + `"}`
+	case "rad_user_info":
+		resp = `{"error":"not_online_error"}`
+		if f.holder != "" && f.ip == ip {
+			resp = `{"error":"ok","user_name":"` + f.holder + `","online_ip":"` + ip + `"}`
+		}
+	case "rad_user_dm":
+		call = append(call, q.Get("username"))
+		f.holder = ""
+		resp = `{"error":"ok"}`
+	case "srun_portal":
+		call = append(call, q.Get("action"))
+		if q.Get("action") == "logout" {
+			f.holder = ""
+			resp = `{"error":"ok"}`
+		} else {
+			f.holder, f.ip = q.Get("username"), ip
+			resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"` + ip + `","online_ip":"` + ip + `"}`
+		}
+	}
+	f.calls = append(f.calls, strings.TrimSpace(strings.Join(append(call, q.Get("ip")), " ")))
+	_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+}
+
+// portal of account a on ip to f
+func (f *fakePortal) portal(t *testing.T, ip string) *portal.Portal {
+	ptl, err := portal.NewPortal("a", "1", strings.TrimPrefix(f.URL, "http://"), ip, portal.LoginTypeQshDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ptl
+}
+
+// takeCalls returns and clears the recorded calls
+func (f *fakePortal) takeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func TestForceLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		holder   string
+		takeover bool
+		occupied bool
+		calls    []string
+	}{
+		{"offline", "", false, false, []string{"rad_user_info", "get_challenge", "srun_portal login 10.0.0.2"}},
+		{"own", "a@dx", false, false, []string{"rad_user_info", "srun_portal logout 10.0.0.2", "get_challenge 10.0.0.2", "srun_portal login 10.0.0.2"}},
+		{"other", "b", false, true, []string{"rad_user_info"}},
+		{"takeover", "b", true, false, []string{"rad_user_info", "rad_user_dm b 10.0.0.2", "get_challenge", "srun_portal login 10.0.0.2"}},
+	}
+	for _, tc := range tests {
+		f := newFakePortal(t, tc.holder)
+		_, err := login(f.portal(t, ""), false, true, tc.takeover)
+		var oe *portal.OccupiedError
+		if tc.occupied {
+			assert.ErrorAs(t, err, &oe, tc.name)
+		} else {
+			assert.NoError(t, err, tc.name)
+		}
+		assert.Equal(t, tc.calls, f.takeCalls(), tc.name)
+	}
+}
+
+func TestRunScheduleClock(t *testing.T) {
+	at := time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC)
+	o := &options{output: outputJSON, sched: "login 0 7 * * *; quiet 00:00-06:00", jitter: time.Minute, loc: time.UTC, clock: func() time.Time { return at }}
+	assert.NoError(t, runSchedule(o, nil))
+	r := o.data.(*scheduleResult)
+	if assert.Len(t, r.Events, 10) {
+		assert.Equal(t, scheduleEvent{At: at.Add(30 * time.Minute), Action: "login"}, r.Events[0])
+	}
+	assert.Equal(t, int64(60), r.JitterSeconds)
+	assert.Equal(t, []string{"00:00-06:00"}, r.Quiet)
+}
+
+func TestRunReportClock(t *testing.T) {
+	at := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	o := &options{output: outputJSON, name: "a@dx", state: t.TempDir(), cycleDay: 1, loc: time.UTC, clock: func() time.Time { return at }}
+	store, err := history.Open(o.state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []history.Sample{
+		{Time: at.AddDate(0, -1, 0), User: "a", Bytes: 1},
+		{Time: at.Add(-2 * time.Hour), User: "a", Bytes: 10},
+		{Time: at.Add(-time.Hour), User: "a", Bytes: 20},
+		{Time: at.Add(-time.Hour), User: "b", Bytes: 5},
+	} {
+		err = store.Append(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, runReport(o, nil))
+	r := o.data.(*usageReport)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), r.CycleStart)
+	assert.Equal(t, 2, r.Samples)
+}
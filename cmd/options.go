@@ -0,0 +1,428 @@
+package cmd
+
+import (
+	"flag"
+	"net/netip"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/gateway"
+	"github.com/fumiama/go-nd-portal/history"
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
+)
+
+// options of all commands, each command registers the flag groups it uses
+type options struct {
+	// global
+	debug    bool
+	warn     bool
+	logfmt   string
+	logfile  string
+	logsize  int64
+	logkeep  int
+	syslog   bool
+	state    string
+	tz       string
+	cycleDay int
+	output   string
+
+	// portal connection
+	server    string
+	cafile    string
+	pin       string
+	insecure  bool
+	timeout   time.Duration
+	dns       string
+	servers   string
+	smode     string
+	rate      time.Duration
+	har       string
+	replay    string
+	ipby      string
+	ipif      string
+	ipcmd     string
+	mismatch  string
+	drop      string
+	dropip    string
+	dropnever string
+	dropfrom  string
+
+	// account
+	name  string
+	pswd  string
+	ip    string
+	types string
+	probe string
+	// probenow logs in with each type to probe, instead of using the saved result
+	probenow bool
+	wait     time.Duration
+
+	// login
+	idem      bool
+	force     bool
+	takeover  bool
+	dry       bool
+	curl      bool
+	challenge string
+	reveal    bool
+	pool      string
+	poolcool  time.Duration
+
+	// long-running
+	interval   time.Duration
+	watch      bool
+	sched      string
+	jitter     time.Duration
+	quotaLimit float64
+	quotaAlert string
+	quotaCap   float64
+	quotaAct   string
+	quotaCmd   string
+	record     bool
+	profiles   string
+
+	// batch
+	jobs     int
+	batchout string
+
+	// gateway
+	arp     string
+	arppoll time.Duration
+	arpmiss int
+
+	// flags parsed
+	flags *flag.FlagSet
+	// clock replaces time.Now of commands without a portal if not nil
+	clock func() time.Time
+	// data of result document
+	data any
+	// set by setup
+	loc    *time.Location
+	logger portal.Logger
+	// set by setupPortal
+	srvs      *portal.Servers
+	configure func(*portal.Portal)
+}
+
+// globalFlags are shared by all commands
+func (o *options) globalFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.warn, "w", false, "only display warn-or-higher-level log")
+	fs.BoolVar(&o.debug, "d", false, "display debug-level log")
+	fs.StringVar(&o.logfmt, "logfmt", "text", "log format, {text | json}")
+	fs.StringVar(&o.logfile, "logfile", "", "append logs to this file instead of stderr, rotated past -logsize")
+	fs.Int64Var(&o.logsize, "logsize", 10, "max MiB of -logfile before rotated, 0 to never rotate")
+	fs.IntVar(&o.logkeep, "logkeep", 3, "rotated -logfile files to keep as .1, .2 ...")
+	fs.BoolVar(&o.syslog, "syslog", false, "send logs to local syslog, not to stderr unless -logfile is set")
+	fs.StringVar(&o.state, "state", defaultStateDir(), "state directory")
+	fs.StringVar(&o.tz, "tz", "Local", "timezone of -sched and billing cycles, e.g. Asia/Shanghai")
+	fs.IntVar(&o.cycleDay, "cycleday", 1, "day of month the billing cycle starts on, [1, 28]")
+	fs.StringVar(&o.output, "output", outputText, "format of command result on stdout, logs always go to stderr, \n {text | json | env}")
+}
+
+// connFlags configure how to reach login host
+func (o *options) connFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.server, "s", "", "login host, auto select when empty, \n an IP, hostname, host:port or base URL like https://portal.example.edu/prefix")
+	fs.StringVar(&o.cafile, "cafile", "", "PEM file of CA certificates to trust for https login host besides system ones")
+	fs.StringVar(&o.pin, "pin", "", "comma separated SHA-256 fingerprints of https login host certificate, \n checked instead of CA chain unless -cafile is set")
+	fs.BoolVar(&o.insecure, "insecure", false, "skip TLS certificate verification of https login host, DANGEROUS")
+	fs.DurationVar(&o.timeout, "timeout", portal.DefaultHTTPOptions.Timeout, "timeout of each request to login host, \n including connecting, TLS handshake and reading response")
+	fs.StringVar(&o.dns, "dns", "", "DNS server host:port to resolve login hostnames, system resolver when empty")
+	fs.StringVar(&o.servers, "servers", "", "comma separated extra login hosts, prefix one by type to use it \n for that type only, e.g. '10.253.0.236,qshd-dx=10.253.0.238'")
+	fs.StringVar(&o.smode, "smode", "failover", "how to pick a login host of -s, built-in and -servers ones, \n {failover | race}")
+	fs.DurationVar(&o.rate, "rate", 0, "min interval between requests to portal shared by all accounts, e.g. 500ms, \n "+profilesRate.String()+" with -profiles unless set")
+	fs.StringVar(&o.har, "har", "", "record HTTP exchanges with login host into this HAR-like JSON file, \n with password, HMAC and info redacted")
+	fs.StringVar(&o.replay, "replay", "", "replay HTTP exchanges recorded by -har instead of sending requests")
+	fs.StringVar(&o.ipby, "ipby", "challenge,route", "client IP strategies in order when -ip is empty, \n {challenge | route | iface | cmd}")
+	fs.StringVar(&o.ipif, "ipif", "", "interface name for iface strategy")
+	fs.StringVar(&o.ipcmd, "ipcmd", "", "command line for cmd strategy, its stdout should be an IP")
+	fs.StringVar(&o.mismatch, "mismatch", "warn", "client IP mismatch policy between request and server response, \n {warn | strict | adopt}")
+	fs.StringVar(&o.drop, "drop", "", "drop a session and retry once on already-online or device-limit error, \n {oldest | ip}, disabled when empty")
+	fs.StringVar(&o.dropip, "dropip", "", "IP of the session to drop for ip rule")
+	fs.StringVar(&o.dropnever, "dropnever", "", "comma separated IPs whose sessions are never dropped")
+	fs.StringVar(&o.dropfrom, "dropfrom", "", "comma separated IPs to look up sessions of the account from")
+}
+
+// userFlags name the account
+func (o *options) userFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.name, "n", query, "username")
+}
+
+// passwordFlags give the password of account
+func (o *options) passwordFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.pswd, "p", query, "password")
+}
+
+// clientFlags pick client IP and login type
+func (o *options) clientFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.ip, "ip", "", "client IP, auto get from login host when empty")
+	fs.StringVar(&o.types, "t", "qsh-edu", "login type, or comma separated types to fall back in order \n on arrears, exhausted or locked errors, \n {qsh-edu | qsh-dx | qshd-dx | qshd-cmcc | sh-edu | sh-dx | sh-cmcc}")
+}
+
+// preloginFlags prepare before the first login
+func (o *options) preloginFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.probe, "probe", "", "host:port to measure RTT of each type in -t to by -probenow")
+	fs.BoolVar(&o.probenow, "probenow", false, "log out and in with each type in -t to measure RTT to -probe, \n saving the fastest one to prefer on later starts")
+	fs.DurationVar(&o.wait, "wait", 0, "wait up to this long for a local client IP before login, e.g. 30s")
+}
+
+// onceFlags control the first login
+func (o *options) onceFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.idem, "idem", false, "skip login if already online, always on in long-running mode")
+	fs.BoolVar(&o.force, "force", false, "logout first then login again")
+	fs.BoolVar(&o.takeover, "takeover", false, "drop another account online on the IP by -force")
+}
+
+// secretFlags control how secrets are computed and shown
+func (o *options) secretFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.challenge, "challenge", "", "challenge to build login URL of -dry-run or decrypt info of inspect, \n a fixed test value for -dry-run when empty")
+	fs.BoolVar(&o.reveal, "reveal", false, "do not redact secrets in -dry-run or inspect output")
+}
+
+// dryRunFlags print requests instead of sending them
+func (o *options) dryRunFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.dry, "dry-run", false, "print challenge and login URLs instead of sending them, secrets redacted")
+	fs.BoolVar(&o.curl, "curl", false, "print -dry-run requests as curl commands")
+}
+
+// poolFlags rotate accounts
+func (o *options) poolFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.pool, "pool", "", "JSON file of accounts in the same format as -profiles to rotate \n when one is in arrears, exhausted or locked")
+	fs.DurationVar(&o.poolcool, "poolcool", 30*time.Minute, "cooldown of a locked account in -pool, \n arrears and exhausted ones cool down until next billing cycle")
+}
+
+// scheduleFlags define login and logout schedule
+func (o *options) scheduleFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.sched, "sched", "", "schedule of long-running mode, rules separated by ';', \n e.g. 'login 0 7 * * *; logout 30 23 * * *; quiet 00:00-06:00; relogin 0 5 * * *'")
+	fs.DurationVar(&o.jitter, "jitter", 0, "max random delay added to scheduled actions")
+}
+
+// quotaFlags guard traffic usage
+func (o *options) quotaFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&o.quotaLimit, "quota", 0, "traffic package limit in GiB for quota guard in long-running mode, 0 to disable")
+	fs.StringVar(&o.quotaAlert, "quotaalert", "80,95", "comma separated percents of -quota to alert")
+	fs.Float64Var(&o.quotaCap, "quotacap", 100, "percent of -quota to take -quotaact, 0 to disable")
+	fs.StringVar(&o.quotaAct, "quotaact", "alert", "action past -quotacap, \n {alert | logout | refuse}")
+	fs.StringVar(&o.quotaCmd, "quotacmd", "", "command line to run on quota alerts, \n with QUOTA_PERCENT, QUOTA_USED, QUOTA_LIMIT and QUOTA_MESSAGE in env")
+}
+
+// daemonFlags keep accounts online, interval flag is named by caller
+func (o *options) daemonFlags(fs *flag.FlagSet, interval string, def time.Duration) {
+	fs.DurationVar(&o.interval, interval, def, "keep online by checking at this interval, e.g. 5m, \n 0 to check only on -watch and -sched")
+	fs.BoolVar(&o.watch, "watch", false, "keep online by re-authenticating on local client IP changes")
+	fs.BoolVar(&o.record, "record", false, "record usage samples into state directory in long-running mode")
+	fs.StringVar(&o.profiles, "profiles", "", "JSON file of accounts to keep online together in supervisor mode")
+}
+
+// batchFlags control batch command
+func (o *options) batchFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.jobs, "j", 4, "max concurrent logins of batch command")
+	fs.StringVar(&o.batchout, "batchout", "", "file to write CSV result report of batch command, stdout if empty")
+}
+
+// gatewayFlags control gateway command
+func (o *options) gatewayFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.arp, "arp", gateway.ARPPath, "neighbor table of gateway command")
+	fs.DurationVar(&o.arppoll, "arppoll", 10*time.Second, "poll interval of neighbor table in gateway command")
+	fs.IntVar(&o.arpmiss, "arpmiss", 3, "polls a neighbor can be missing before logged out in gateway command")
+}
+
+// setup applies global flags
+func (o *options) setup() error {
+	err := checkOutput(o.output)
+	if err != nil {
+		return err
+	}
+	if o.debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	} else if o.warn {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+	err = setupLog(o.logfmt, o.logfile, o.logsize<<20, o.logkeep, o.syslog)
+	if err != nil {
+		return err
+	}
+	o.logger = portal.NewLogrusLogger(logrus.StandardLogger())
+	o.loc, err = time.LoadLocation(o.tz)
+	if err != nil {
+		return err
+	}
+	if o.cycleDay < 1 || o.cycleDay > 28 {
+		return quota.ErrIllegalCycleDay
+	}
+	return nil
+}
+
+// profilesRate is -rate of -profiles if not set,
+// so that accounts starting together do not flood the portal
+const profilesRate = 200 * time.Millisecond
+
+// now returns the time of commands without a portal
+func (o *options) now() time.Time {
+	if o.clock != nil {
+		return o.clock()
+	}
+	return time.Now()
+}
+
+// isSet reports whether flag name is given on command line
+func (o *options) isSet(name string) bool {
+	set := false
+	if o.flags != nil {
+		o.flags.Visit(func(f *flag.Flag) {
+			set = set || f.Name == name
+		})
+	}
+	return set
+}
+
+// setupPortal checks connection flags, applies HTTP settings and makes o.configure
+func (o *options) setupPortal() error {
+	if o.ip != "" {
+		// just validate IP here,
+		// dont convert to net.IP because we need only its string later
+		_, err := netip.ParseAddr(o.ip)
+		if err != nil {
+			return err
+		}
+	}
+	strategies, err := portal.ParseIPStrategies(o.ipby)
+	if err != nil {
+		return err
+	}
+	mp, err := portal.ParseMismatchPolicy(o.mismatch)
+	if err != nil {
+		return err
+	}
+	dr, err := portal.ParseDropRule(o.drop)
+	if err != nil {
+		return err
+	}
+	portal.SetDNSServer(o.dns)
+	switch {
+	case o.replay != "":
+		rec, err := portal.LoadRecording(o.replay)
+		if err != nil {
+			return err
+		}
+		portal.SetRoundTripper(portal.NewReplayer(rec))
+	case o.har != "":
+		portal.SetRoundTripper(&portal.Recorder{Path: o.har, Log: o.logger})
+	}
+	if o.timeout > 0 {
+		ho := portal.DefaultHTTPOptions
+		ho.Timeout = o.timeout
+		for _, d := range []*time.Duration{&ho.DialTimeout, &ho.TLSTimeout, &ho.ResponseTimeout} {
+			if *d > o.timeout {
+				*d = o.timeout
+			}
+		}
+		portal.SetHTTPOptions(ho)
+	}
+	if o.cafile != "" || o.pin != "" || o.insecure {
+		err := portal.SetTLS(&portal.TLSOptions{
+			CAFile:   o.cafile,
+			Pins:     splitList(o.pin),
+			Insecure: o.insecure,
+			Log:      o.logger,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if o.server != "" {
+		err := checkServer(o.server)
+		if err != nil {
+			return err
+		}
+	}
+	if o.servers != "" || o.smode != string(portal.ServerModeFailover) {
+		extra, err := parseServers(o.servers)
+		if err != nil {
+			return err
+		}
+		mode, err := portal.ParseServerMode(o.smode)
+		if err != nil {
+			return err
+		}
+		o.srvs = &portal.Servers{Extra: extra, Mode: mode}
+		loadServers(o.state, o.srvs)
+	}
+	if o.profiles != "" && !o.isSet("rate") {
+		o.rate = profilesRate
+	}
+	var limiter *portal.RateLimiter
+	if o.rate > 0 {
+		limiter = portal.NewRateLimiter(o.rate)
+	}
+	// configure applies shared settings to ptl
+	o.configure = func(ptl *portal.Portal) {
+		ptl.SetClientIPResolver(&portal.ClientIPResolver{
+			Strategies: strategies,
+			Interface:  o.ipif,
+			Command:    o.ipcmd,
+		})
+		ptl.SetLogger(o.logger)
+		ptl.SetMismatchPolicy(mp)
+		if dr != "" {
+			ptl.SetDropPolicy(&portal.DropPolicy{
+				Rule:         dr,
+				IP:           o.dropip,
+				Never:        splitList(o.dropnever),
+				CandidateIPs: splitList(o.dropfrom),
+			})
+		}
+		ptl.SetRateLimiter(limiter)
+		if o.srvs != nil {
+			ptl.SetServers(o.srvs)
+		}
+	}
+	return nil
+}
+
+// schedule parses -sched, nil if empty
+func (o *options) schedule() (*schedule.Schedule, error) {
+	if o.sched == "" {
+		return nil, nil
+	}
+	sch, err := schedule.Parse(o.sched)
+	if err != nil {
+		return nil, err
+	}
+	sch.Location = o.loc
+	sch.Jitter = o.jitter
+	return sch, nil
+}
+
+// guard makes quota guard of -quota, nil if disabled
+func (o *options) guard() (*quota.Guard, error) {
+	if o.quotaLimit <= 0 {
+		return nil, nil
+	}
+	ths, err := quota.ParseThresholds(o.quotaAlert)
+	if err != nil {
+		return nil, err
+	}
+	act, err := quota.ParseAction(o.quotaAct)
+	if err != nil {
+		return nil, err
+	}
+	return &quota.Guard{
+		Limit:      int64(o.quotaLimit * quota.GiB),
+		Thresholds: ths,
+		Cap:        o.quotaCap,
+		Action:     act,
+		CycleDay:   o.cycleDay,
+		Location:   o.loc,
+	}, nil
+}
+
+// history opens usage store if -record, nil if not
+func (o *options) history() (*history.Store, error) {
+	if !o.record {
+		return nil, nil
+	}
+	return history.Open(o.state)
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
+)
+
+// errIllegalOutput is returned when -output is not text, json or env
+var errIllegalOutput = errors.New("illegal output format")
+
+const (
+	// outputText prints human readable text
+	outputText = "text"
+	// outputJSON prints a result document in JSON
+	outputJSON = "json"
+	// outputEnv prints the result document as shell variables to eval
+	outputEnv = "env"
+)
+
+// envPrefix of variables printed by -output env
+const envPrefix = "PORTAL_"
+
+// result document of a command printed by -output json or env
+type result struct {
+	Command string `json:"command"`
+	OK      bool   `json:"ok"`
+	// Error of failed command
+	Error *resultError `json:"error,omitempty"`
+	// Data of command, whose fields depend on command
+	Data any `json:"data,omitempty"`
+}
+
+// resultError is a classified error
+type resultError struct {
+	// Code is a portal.ErrorKind, or one of usage, occupied, http, network and unknown
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// usageErrors are caused by illegal flags or arguments
+var usageErrors = []error{
+	errMissingArg, errNoWakeUp, errIllegalFlag, errBatchIP, errReportUser, errUnknownCommand, errUnknownShell, errWatchWithIP, errIllegalOutput, errIllegalLogFormat,
+	portal.ErrIllegalLoginType, portal.ErrIllegalIPStrategy, portal.ErrIllegalMismatchPolicy,
+	portal.ErrIllegalDropRule, portal.ErrIllegalServerMode, portal.ErrIllegalServer, portal.ErrIllegalPin,
+	quota.ErrIllegalAction, quota.ErrIllegalThreshold, quota.ErrIllegalCycleDay,
+	schedule.ErrIllegalAction, schedule.ErrIllegalSpec, schedule.ErrIllegalWindow,
+}
+
+// errorCode classifies err
+func errorCode(err error) string {
+	if kind := portal.Classify(err); kind != portal.ErrorKindUnknown {
+		return string(kind)
+	}
+	for _, e := range usageErrors {
+		if errors.Is(err, e) {
+			return "usage"
+		}
+	}
+	var (
+		oe *portal.OccupiedError
+		se *portal.StatusError
+		re *portal.RedirectError
+		ne net.Error
+	)
+	switch {
+	case errors.As(err, &oe):
+		return "occupied"
+	case errors.As(err, &se), errors.As(err, &re), errors.Is(err, portal.ErrBodyTooLarge):
+		return "http"
+	case errors.As(err, &ne):
+		return "network"
+	}
+	return "unknown"
+}
+
+// newResultError classifies err, nil if err is nil
+func newResultError(err error) *resultError {
+	if err == nil {
+		return nil
+	}
+	return &resultError{Code: errorCode(err), Message: portal.Redact(err.Error())}
+}
+
+// checkOutput validates -output
+func checkOutput(output string) error {
+	switch output {
+	case outputText, outputJSON, outputEnv:
+		return nil
+	default:
+		return errIllegalOutput
+	}
+}
+
+// outputArg finds -output in args which could not be parsed,
+// so that errors of flag parsing are written in the right format
+func outputArg(args []string) string {
+	for i, a := range args {
+		a = strings.TrimPrefix(strings.TrimPrefix(a, "-"), "-")
+		v := ""
+		switch {
+		case strings.HasPrefix(a, "output="):
+			v = strings.TrimPrefix(a, "output=")
+		case a == "output" && i+1 < len(args):
+			v = args[i+1]
+		}
+		if checkOutput(v) == nil {
+			return v
+		}
+	}
+	return outputText
+}
+
+// setResult sets data of the result document, printing it by text in text output
+func (o *options) setResult(data any, text func()) {
+	o.data = data
+	if o.output == outputText && text != nil {
+		text()
+	}
+}
+
+// writeResult writes the result document of command named name with err to w,
+// nothing in text output
+func (o *options) writeResult(w io.Writer, name string, err error) error {
+	doc := result{Command: name, OK: err == nil, Error: newResultError(err), Data: o.data}
+	switch o.output {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(doc)
+	case outputEnv:
+		return writeEnv(w, doc)
+	}
+	return nil
+}
+
+// writeEnv writes doc as sorted shell assignments like PORTAL_ERROR_CODE='network',
+// flattening data fields to top level and arrays to KEY_0_FIELD with KEY_COUNT
+func writeEnv(w io.Writer, doc result) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	err = dec.Decode(&m)
+	if err != nil {
+		return err
+	}
+	if d, ok := m["data"].(map[string]any); ok {
+		delete(m, "data")
+		for k, v := range d {
+			m[k] = v
+		}
+	}
+	env := make(map[string]string)
+	flattenEnv(strings.TrimSuffix(envPrefix, "_"), m, env)
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, err = fmt.Fprintf(w, "%s=%s\n", k, shellQuote(env[k]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flattenEnv puts v into env under key, joining nested keys by '_'
+func flattenEnv(key string, v any, env map[string]string) {
+	switch x := v.(type) {
+	case map[string]any:
+		for k, item := range x {
+			flattenEnv(key+"_"+strings.ToUpper(k), item, env)
+		}
+	case []any:
+		env[key+"_COUNT"] = fmt.Sprint(len(x))
+		for i, item := range x {
+			flattenEnv(fmt.Sprintf("%s_%d", key, i), item, env)
+		}
+	case nil:
+	default:
+		env[key] = fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+func TestWriteResult(t *testing.T) {
+	at := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	data := &scheduleResult{
+		Events:        []scheduleEvent{{At: at, Action: "login"}, {At: at.Add(time.Hour), Action: "logout"}},
+		JitterSeconds: 30,
+		Quiet:         []string{},
+	}
+	tests := []struct {
+		output string
+		data   any
+		err    error
+		want   string
+	}{
+		{outputText, data, nil, ""},
+		{
+			outputJSON, data, nil,
+			`{"command":"schedule","ok":true,"data":{"events":[{"at":"2024-03-01T08:00:00Z","action":"login"},{"at":"2024-03-01T09:00:00Z","action":"logout"}],"jitter_seconds":30,"quiet":[]}}` + "\n",
+		},
+		{
+			outputJSON, nil, &detailError{err: errIllegalFlag, detail: "a<b"}, `{"command":"schedule","ok":false,"error":{"code":"usage","message":"illegal flag: a<b"}}` + "\n",
+		},
+		{
+			outputEnv, data, nil,
+			"PORTAL_COMMAND='schedule'\n" +
+				"PORTAL_EVENTS_0_ACTION='login'\n" +
+				"PORTAL_EVENTS_0_AT='2024-03-01T08:00:00Z'\n" +
+				"PORTAL_EVENTS_1_ACTION='logout'\n" +
+				"PORTAL_EVENTS_1_AT='2024-03-01T09:00:00Z'\n" +
+				"PORTAL_EVENTS_COUNT='2'\n" +
+				"PORTAL_JITTER_SECONDS='30'\n" +
+				"PORTAL_OK='true'\n" +
+				"PORTAL_QUIET_COUNT='0'\n",
+		},
+		{
+			outputEnv, &loginResult{UserName: "it's", AlreadyOnline: true}, errors.New("bad"),
+			"PORTAL_ALREADY_ONLINE='true'\n" +
+				"PORTAL_CLIENT_IP=''\n" +
+				"PORTAL_COMMAND='schedule'\n" +
+				"PORTAL_ERROR_CODE='unknown'\n" +
+				"PORTAL_ERROR_MESSAGE='bad'\n" +
+				"PORTAL_OK='false'\n" +
+				"PORTAL_ONLINE_IP=''\n" +
+				"PORTAL_SERVER=''\n" +
+				"PORTAL_TYPE=''\n" +
+				`PORTAL_USERNAME='it'\''s'` + "\n",
+		},
+	}
+	for _, tc := range tests {
+		o := &options{output: tc.output, data: tc.data}
+		var sb strings.Builder
+		assert.NoError(t, o.writeResult(&sb, "schedule", tc.err))
+		assert.Equal(t, tc.want, sb.String(), tc.output)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errMissingArg, "usage"},
+		{&detailError{err: errUnknownCommand, detail: "foo"}, "usage"},
+		{&batchIPError{Entry: 2}, "usage"},
+		{portal.ErrIllegalLoginType, "usage"},
+		{&portal.OccupiedError{IP: "10.0.0.2", UserName: "a"}, "occupied"},
+		{&portal.StatusError{}, "http"},
+		{&portal.RedirectError{}, "http"},
+		{portal.ErrBodyTooLarge, "http"},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, "network"},
+		{&net.DNSError{Err: "no such host"}, "network"},
+		{errors.New("bad"), "unknown"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, errorCode(tc.err), tc.err.Error())
+	}
+}
+
+func TestOutputArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, outputText},
+		{[]string{"-u", "a", "-output", "json"}, outputJSON},
+		{[]string{"--output=env", "-bad"}, outputEnv},
+		{[]string{"-output=yaml"}, outputText},
+		{[]string{"-output"}, outputText},
+		{[]string{"-u", "output", "-output", "env"}, outputEnv},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, outputArg(tc.args), strings.Join(tc.args, " "))
+	}
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"time"
+)
+
+// cooldownsFile in state dir
+const cooldownsFile = "cooldowns.json"
+
+// loadCooldowns reads cooldowns of pool from state dir, empty if not exist
+func loadCooldowns(dir string) map[string]time.Time {
+	cooldowns := make(map[string]time.Time)
+	loadState(dir, cooldownsFile, &cooldowns)
+	return cooldowns
+}
+
+// saveCooldowns writes cooldowns of pool into state dir
+func saveCooldowns(dir string, cooldowns map[string]time.Time) {
+	saveState(dir, cooldownsFile, cooldowns)
+}
+
+// keepPool keeps one account of d.pool online and switches d.ptl to it
+func (d *daemon) keepPool() error {
+	ptl, err := d.pool.Keep()
+	if ptl != nil {
+		d.ptl = ptl
+	}
+	saveCooldowns(d.state, d.pool.Cooldowns)
+	return err
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/helper"
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+)
+
+// quotaFile in state dir, quota states by username
+const quotaFile = "quota.json"
+
+// quotaMu serializes access to quotaFile of concurrent daemons
+var quotaMu sync.Mutex
+
+// loadQuota restores alerts fired and cap of user into g from state dir,
+// so that a restarted daemon past cap does not log in again
+func loadQuota(dir, user string, g *quota.Guard) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	states := make(map[string]quota.State)
+	loadState(dir, quotaFile, &states)
+	if st, ok := states[user]; ok {
+		g.Restore(st)
+	}
+}
+
+// saveQuota writes state of g of user into state dir if changed
+func saveQuota(dir, user string, g *quota.Guard) {
+	quotaMu.Lock()
+	defer quotaMu.Unlock()
+	states := make(map[string]quota.State)
+	loadState(dir, quotaFile, &states)
+	st := g.State()
+	if old, ok := states[user]; ok && old.Equal(st) {
+		return
+	}
+	states[user] = st
+	saveState(dir, quotaFile, states)
+}
+
+// checkQuota handles alerts and cap by g on usage in st
+func checkQuota(ptl *portal.Portal, g *quota.Guard, alertcmd string, now time.Time, st *portal.UserStatus) {
+	for _, a := range g.Check(now, st.SumBytes) {
+		logrus.Warnln(a)
+		if alertcmd != "" {
+			runAlert(alertcmd, a)
+		}
+	}
+	if g.ShouldLogout() {
+		logrus.Warnln("traffic usage crossed cap, logout until", g.CycleEnd(now))
+		err := ptl.Logout()
+		if err != nil {
+			logrus.Errorln("logout by quota failed:", err)
+		}
+	}
+}
+
+// runAlert runs cmdline in system shell with alert in env
+func runAlert(cmdline string, a quota.Alert) {
+	c := helper.ShellCommand(cmdline)
+	c.Env = append(os.Environ(),
+		"QUOTA_PERCENT="+strconv.FormatFloat(a.Percent, 'g', -1, 64),
+		"QUOTA_USED="+strconv.FormatInt(a.Used, 10),
+		"QUOTA_LIMIT="+strconv.FormatInt(a.Limit, 10),
+		"QUOTA_MESSAGE="+a.String(),
+	)
+	c.Stdout = os.Stderr
+	c.Stderr = os.Stderr
+	err := c.Run()
+	if err != nil {
+		logrus.Warnln("run quota alert command:", err)
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/fumiama/go-nd-portal/history"
+	"github.com/fumiama/go-nd-portal/quota"
+)
+
+// errReportUser is returned when history has samples of several accounts but -n is not given
+var errReportUser = errors.New("usage of several accounts recorded, choose one by -n")
+
+// defaultStateDir returns $XDG_STATE_HOME/go-nd-portal or its platform fallback
+func defaultStateDir() string {
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return filepath.Join(d, "go-nd-portal")
+	}
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		if h, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(h, ".local", "state", "go-nd-portal")
+		}
+	}
+	if d, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(d, "go-nd-portal")
+	}
+	return "."
+}
+
+// formatBytes formats n in binary units
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %s", n, units[i])
+}
+
+// printPeriods prints periods with bars
+func printPeriods(title, layout string, periods []history.Period) {
+	fmt.Println(title + ":")
+	var max int64
+	for _, p := range periods {
+		if p.Bytes > max {
+			max = p.Bytes
+		}
+	}
+	for _, p := range periods {
+		fmt.Printf("  %s %12s %8s  %s\n", p.Start.Format(layout), formatBytes(float64(p.Bytes)),
+			(time.Duration(p.Seconds) * time.Second).Round(time.Minute), history.Bar(p.Bytes, max, 30))
+	}
+}
+
+// usageReport of report command
+type usageReport struct {
+	CycleStart  time.Time         `json:"cycle_start"`
+	CycleEnd    time.Time         `json:"cycle_end"`
+	Samples     int               `json:"samples"`
+	Daily       []usagePeriod     `json:"daily"`
+	Weekly      []usagePeriod     `json:"weekly"`
+	Throughputs []usageThroughput `json:"throughputs"`
+	// ForecastBytes at cycle end, 0 if not enough samples
+	ForecastBytes int64 `json:"forecast_bytes"`
+	// LimitBytes of -quota, 0 if not set
+	LimitBytes int64 `json:"limit_bytes"`
+
+	loc      *time.Location
+	forecast bool
+	daily    []history.Period
+	weekly   []history.Period
+}
+
+// usagePeriod is usage in a day or week
+type usagePeriod struct {
+	Start   time.Time `json:"start"`
+	Bytes   int64     `json:"bytes"`
+	Seconds int64     `json:"seconds"`
+}
+
+// usageThroughput is average throughput between two samples
+type usageThroughput struct {
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	BytesPerSecond float64   `json:"bytes_per_second"`
+}
+
+// usagePeriods converts periods
+func usagePeriods(periods []history.Period) []usagePeriod {
+	ups := make([]usagePeriod, len(periods))
+	for i, p := range periods {
+		ups[i] = usagePeriod{Start: p.Start, Bytes: p.Bytes, Seconds: p.Seconds}
+	}
+	return ups
+}
+
+// newUsageReport builds usage report of the billing cycle containing now
+func newUsageReport(st *history.Store, user string, g *quota.Guard, now time.Time) (*usageReport, error) {
+	loc := g.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	start, end := g.CycleStart(now), g.CycleEnd(now)
+	samples, err := st.Load(user, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if user == "" {
+		// deltas of different accounts must not be summed up
+		var users []string
+		seen := make(map[string]bool)
+		for _, s := range samples {
+			u := history.Account(s.User)
+			if !seen[u] {
+				seen[u] = true
+				users = append(users, u)
+			}
+		}
+		if len(users) > 1 {
+			return nil, &detailError{err: errReportUser, detail: strings.Join(users, ", ")}
+		}
+	}
+	r := &usageReport{
+		CycleStart:  start,
+		CycleEnd:    end,
+		Samples:     len(samples),
+		Daily:       []usagePeriod{},
+		Weekly:      []usagePeriod{},
+		Throughputs: []usageThroughput{},
+		LimitBytes:  g.Limit,
+		loc:         loc,
+	}
+	if len(samples) < 2 {
+		return r, nil
+	}
+	r.daily, r.weekly = history.Daily(samples, loc), history.Weekly(samples, loc)
+	r.Daily, r.Weekly = usagePeriods(r.daily), usagePeriods(r.weekly)
+	ts := history.Throughputs(samples)
+	if len(ts) > 10 {
+		ts = ts[len(ts)-10:]
+	}
+	for _, t := range ts {
+		r.Throughputs = append(r.Throughputs, usageThroughput{From: t.From, To: t.To, BytesPerSecond: t.BytesPerSecond})
+	}
+	r.ForecastBytes, r.forecast = history.Forecast(samples, start, end)
+	return r, nil
+}
+
+// print writes r to stdout
+func (r *usageReport) print() {
+	fmt.Printf("billing cycle: %s ~ %s, %d samples\n", r.CycleStart.Format("2006-01-02"), r.CycleEnd.Format("2006-01-02"), r.Samples)
+	if r.Samples < 2 {
+		fmt.Println("not enough samples, record them by -record in long-running mode")
+		return
+	}
+	printPeriods("daily", "2006-01-02 Mon", r.daily)
+	printPeriods("weekly", "2006-01-02 Mon", r.weekly)
+	fmt.Println("average throughput between samples:")
+	for _, t := range r.Throughputs {
+		fmt.Printf("  %s ~ %s %12s/s\n", t.From.In(r.loc).Format("01-02 15:04"), t.To.In(r.loc).Format("01-02 15:04"), formatBytes(t.BytesPerSecond))
+	}
+	if r.forecast {
+		fmt.Printf("forecast at cycle end: %s", formatBytes(float64(r.ForecastBytes)))
+		if r.LimitBytes > 0 {
+			fmt.Printf(" (%.1f%% of %s)", float64(r.ForecastBytes)*100/float64(r.LimitBytes), formatBytes(float64(r.LimitBytes)))
+		}
+		fmt.Println()
+	}
+}
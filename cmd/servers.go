@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// serversFile in state dir
+const serversFile = "servers.json"
+
+// parseServers parses comma separated servers, each optionally prefixed by
+// a login type like "qshd-dx=10.253.0.236" to be used for that type only
+func parseServers(s string) (map[portal.LoginType][]string, error) {
+	extra := make(map[portal.LoginType][]string)
+	for _, item := range splitList(s) {
+		var lt portal.LoginType
+		if i := strings.Index(item, "="); i >= 0 {
+			// '=' may also be in the path of a base URL
+			t := portal.LoginType(strings.TrimSpace(item[:i]))
+			if _, _, err := t.ToDomainAcID(); err == nil {
+				lt, item = t, strings.TrimSpace(item[i+1:])
+			}
+		}
+		err := checkServer(item)
+		if err != nil {
+			return nil, err
+		}
+		extra[lt] = append(extra[lt], item)
+	}
+	return extra, nil
+}
+
+// loadServers restores health of s from state dir
+func loadServers(dir string, s *portal.Servers) {
+	var st portal.ServersState
+	loadState(dir, serversFile, &st)
+	s.Restore(st)
+}
+
+// saveServers writes health of s into state dir
+func saveServers(dir string, s *portal.Servers) {
+	st := s.State()
+	saveState(dir, serversFile, &st)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loadState reads JSON file name in state dir into v, leaving v untouched if not exist
+func loadState(dir, name string, v any) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnln("load", name+":", err)
+		}
+		return
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		logrus.Warnln("load", name+":", err)
+	}
+}
+
+// saveState writes v as JSON file name into state dir atomically
+func saveState(dir, name string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = os.MkdirAll(dir, 0o700)
+	}
+	if err == nil {
+		tmp := filepath.Join(dir, name+".tmp")
+		err = os.WriteFile(tmp, data, 0o600)
+		if err == nil {
+			err = os.Rename(tmp, filepath.Join(dir, name))
+		}
+	}
+	if err != nil {
+		logrus.Warnln("save", name+":", err)
+	}
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/portal"
+)
+
+// statusPortal makes a portal to logout or query status, which needs no password
+func (o *options) statusPortal() (*portal.Portal, error) {
+	err := o.setupPortal()
+	if err != nil {
+		return nil, err
+	}
+	types, err := portal.ParseLoginTypes(o.types)
+	if err != nil {
+		return nil, err
+	}
+	name := o.name
+	if name == query {
+		name = ""
+	}
+	ptl, err := portal.NewPortal(name, "", o.server, o.ip, types[0])
+	if err != nil {
+		return nil, err
+	}
+	o.configure(ptl)
+	return ptl, nil
+}
+
+// runLogout logs the account out on client IP
+func runLogout(o *options, _ []string) error {
+	if o.name == query {
+		fmt.Fprint(os.Stderr, "username: ")
+		_, err := fmt.Scanln(&o.name)
+		if err != nil {
+			return err
+		}
+	}
+	ptl, err := o.statusPortal()
+	if err != nil {
+		return err
+	}
+	if o.ip == "" {
+		// client ip is resolved along with challenge
+		_, err = ptl.GetChallenge()
+		if err != nil {
+			return err
+		}
+	}
+	o.setResult(&logoutResult{UserName: ptl.UserName(), ClientIP: ptl.ClientIP()}, nil)
+	err = ptl.Logout()
+	if err != nil {
+		return err
+	}
+	logrus.Infoln("logged out")
+	return nil
+}
+
+// logoutResult of logout command
+type logoutResult struct {
+	UserName string `json:"username"`
+	ClientIP string `json:"client_ip"`
+}
+
+// statusResult of status command
+type statusResult struct {
+	Online   bool   `json:"online"`
+	UserName string `json:"username"`
+	ClientIP string `json:"client_ip"`
+	OnlineIP string `json:"online_ip"`
+	// AddTime is unix seconds when the session went online
+	AddTime     int64   `json:"add_time"`
+	SumBytes    int64   `json:"sum_bytes"`
+	SumSeconds  int64   `json:"sum_seconds"`
+	UserBalance float64 `json:"user_balance"`
+}
+
+// runStatus prints online status of client IP
+func runStatus(o *options, _ []string) error {
+	ptl, err := o.statusPortal()
+	if err != nil {
+		return err
+	}
+	s, err := ptl.Status()
+	if err != nil {
+		return err
+	}
+	o.setResult(&statusResult{
+		Online:      s.Online(),
+		UserName:    s.UserName,
+		ClientIP:    s.ClientIP,
+		OnlineIP:    s.OnlineIP,
+		AddTime:     s.AddTime,
+		SumBytes:    s.SumBytes,
+		SumSeconds:  s.SumSeconds,
+		UserBalance: s.UserBalance,
+	}, func() {
+		printStatus(s, ptl.Now())
+	})
+	return nil
+}
+
+// printStatus prints fields of s as a table
+func printStatus(s *portal.UserStatus, now time.Time) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !s.Online() {
+		fmt.Fprintln(tw, "online\tno")
+		if s.ClientIP != "" {
+			fmt.Fprintln(tw, "client ip\t"+s.ClientIP)
+		}
+		_ = tw.Flush()
+		return
+	}
+	since := time.Unix(s.AddTime, 0)
+	fmt.Fprintln(tw, "online\tyes")
+	fmt.Fprintln(tw, "user\t"+s.UserName)
+	fmt.Fprintln(tw, "client ip\t"+s.ClientIP)
+	fmt.Fprintln(tw, "online ip\t"+s.OnlineIP)
+	fmt.Fprintf(tw, "since\t%s (%s)\n", since.Format("2006-01-02 15:04:05"), now.Sub(since).Truncate(time.Second))
+	fmt.Fprintln(tw, "traffic\t"+formatBytes(float64(s.SumBytes)))
+	fmt.Fprintln(tw, "duration\t"+(time.Duration(s.SumSeconds)*time.Second).String())
+	fmt.Fprintf(tw, "balance\t%.2f\n", s.UserBalance)
+	_ = tw.Flush()
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/fumiama/go-nd-portal/history"
+	"github.com/fumiama/go-nd-portal/portal"
+	"github.com/fumiama/go-nd-portal/quota"
+	"github.com/fumiama/go-nd-portal/schedule"
+)
+
+// profile of one account in supervisor mode
+type profile struct {
+	// Name shown in status table, username if empty
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Type of login, qsh-edu if empty
+	Type string `json:"type"`
+	// IP of client, resolved by strategies if empty
+	IP string `json:"ip"`
+	// Server of portal, auto select if empty
+	Server string `json:"server"`
+	// Interval of keepalive checks like "5m", -daemon if empty
+	Interval string `json:"interval"`
+}
+
+// loadProfiles reads a JSON array of profiles from file
+func loadProfiles(file string) ([]profile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []profile
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		pf := &profiles[i]
+		if pf.Name == "" {
+			pf.Name = pf.Username
+		}
+		if pf.Type == "" {
+			pf.Type = string(portal.LoginTypeQshEdu)
+		}
+	}
+	return profiles, nil
+}
+
+// profileDaemon returns the func making the daemon of a profile in supervisor mode,
+// with flags as defaults and a quota guard of its own
+func (o *options) profileDaemon(sch *schedule.Schedule, guard *quota.Guard, store *history.Store) func(*profile) (*daemon, error) {
+	return func(pf *profile) (*daemon, error) {
+		if pf.Server == "" {
+			pf.Server = o.server
+		}
+		ptl, err := portal.NewPortal(pf.Username, pf.Password, pf.Server, pf.IP, portal.LoginType(pf.Type))
+		if err != nil {
+			return nil, err
+		}
+		o.configure(ptl)
+		d := &daemon{
+			ptl:      ptl,
+			interval: o.interval,
+			force:    o.force,
+			takeover: o.takeover,
+			watch:    o.watch && pf.IP == "",
+			sched:    sch,
+			alertcmd: o.quotaCmd,
+			history:  store,
+			state:    o.state,
+		}
+		if pf.Interval != "" {
+			d.interval, err = time.ParseDuration(pf.Interval)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if d.interval <= 0 {
+			d.interval = 5 * time.Minute
+		}
+		if guard != nil {
+			g := *guard
+			d.quota = &g
+		}
+		return d, nil
+	}
+}
+
+// workerStatus of one account
+type workerStatus struct {
+	name     string
+	ip       string
+	state    string
+	err      error
+	rounds   int
+	failures int
+	last     time.Time
+}
+
+// supervisor runs a daemon for each profile
+type supervisor struct {
+	// out receives status table, stdout if nil
+	out      io.Writer
+	mu       sync.Mutex
+	statuses []*workerStatus
+}
+
+// run starts workers made by newDaemon and prints status table every interval
+func (s *supervisor) run(profiles []profile, newDaemon func(*profile) (*daemon, error), interval time.Duration) {
+	s.start(profiles, newDaemon, s.keep)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for {
+		s.print()
+		time.Sleep(interval)
+	}
+}
+
+// start makes the daemon of each profile by newDaemon and runs it by keep in background
+func (s *supervisor) start(profiles []profile, newDaemon func(*profile) (*daemon, error), keep func(string, *daemon)) {
+	for i := range profiles {
+		pf := &profiles[i]
+		ws := &workerStatus{name: pf.Name, state: "starting"}
+		s.statuses = append(s.statuses, ws)
+		d, err := newDaemon(pf)
+		if err != nil {
+			ws.state, ws.err = "invalid", err
+			logrus.Errorln("account", pf.Name, "invalid:", err)
+			continue
+		}
+		d.onRound = func(state string, err error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			ws.ip, ws.state, ws.err, ws.last = d.ptl.ClientIP(), state, err, d.now()
+			ws.rounds++
+			if err != nil {
+				ws.failures++
+			}
+		}
+		go keep(pf.Name, d)
+	}
+}
+
+// keep runs d, restarting it if it panics so that one account cant break others
+func (s *supervisor) keep(name string, d *daemon) {
+	for {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.Errorln("account", name, "worker panic:", r)
+				}
+			}()
+			d.run()
+		}()
+		time.Sleep(time.Minute)
+	}
+}
+
+// print writes the aggregated status table to s.out
+func (s *supervisor) print() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out io.Writer = os.Stdout
+	if s.out != nil {
+		out = s.out
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACCOUNT\tCLIENT IP\tSTATE\tROUNDS\tFAILURES\tLAST CHECK\tERROR")
+	for _, ws := range s.statuses {
+		last, errmsg := "-", ""
+		if !ws.last.IsZero() {
+			last = ws.last.Format("01-02 15:04:05")
+		}
+		if ws.err != nil {
+			errmsg = portal.Redact(ws.err.Error())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", ws.name, ws.ip, ws.state, ws.rounds, ws.failures, last, errmsg)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fumiama/go-nd-portal/quota"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	pfs, err := loadProfiles(writeTemp(t, "p.json", `[{"username":"a","password":"1"},{"name":"lab","username":"b","type":"qshd-dx","ip":"10.0.0.3","interval":"30s"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []profile{
+		{Name: "a", Username: "a", Password: "1", Type: "qsh-edu"},
+		{Name: "lab", Username: "b", Type: "qshd-dx", IP: "10.0.0.3", Interval: "30s"},
+	}, pfs)
+	_, err = loadProfiles(writeTemp(t, "q.json", `{}`))
+	assert.Error(t, err)
+}
+
+func TestProfileDaemon(t *testing.T) {
+	file := writeTemp(t, "p.json", "[]")
+	for _, tc := range []struct {
+		args []string
+		rate time.Duration
+	}{
+		{nil, profilesRate},
+		{[]string{"-rate", "0"}, 0},
+		{[]string{"-rate", "1s"}, time.Second},
+	} {
+		o := &options{}
+		err := lookupCommand("daemon").flagSet(o).Parse(append(tc.args, "-profiles", file, "-s", "10.0.0.1", "-interval", "1m", "-watch"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(t, o.setupPortal())
+		assert.Equal(t, tc.rate, o.rate, tc.args)
+	}
+
+	o := &options{}
+	err := lookupCommand("daemon").flagSet(o).Parse([]string{"-profiles", file, "-s", "10.0.0.1", "-interval", "0", "-watch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, o.setupPortal())
+	guard := &quota.Guard{Limit: 1}
+	newDaemon := o.profileDaemon(nil, guard, nil)
+
+	d, err := newDaemon(&profile{Username: "a", Type: "qsh-edu"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5*time.Minute, d.interval)
+		assert.True(t, d.watch)
+		assert.Equal(t, "10.0.0.1", d.ptl.Server())
+		assert.NotSame(t, guard, d.quota)
+	}
+	d2, err := newDaemon(&profile{Username: "b", Type: "qsh-edu", IP: "10.0.0.3", Server: "10.0.0.9", Interval: "30s"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 30*time.Second, d2.interval)
+		assert.False(t, d2.watch)
+		assert.Equal(t, "10.0.0.9", d2.ptl.Server())
+		assert.NotSame(t, d.quota, d2.quota)
+	}
+	_, err = newDaemon(&profile{Username: "c", Type: "qsh-edu", Interval: "soon"})
+	assert.Error(t, err)
+	_, err = newDaemon(&profile{Username: "c", Type: "nope"})
+	assert.Error(t, err)
+}
+
+func TestSupervisorStatus(t *testing.T) {
+	f := newFakePortal(t, "")
+	errBad := errors.New("bad profile")
+	var sb strings.Builder
+	sv := &supervisor{out: &sb}
+	done := make(chan struct{})
+	defer close(done)
+	sv.start([]profile{{Name: "lab"}, {Name: "bad"}}, func(pf *profile) (*daemon, error) {
+		if pf.Name == "bad" {
+			return nil, errBad
+		}
+		return &daemon{ptl: f.portal(t, "10.0.0.2")}, nil
+	}, func(_ string, d *daemon) {
+		d.loop(nil, nil, done)
+	})
+	assert.Eventually(t, func() bool {
+		sv.mu.Lock()
+		defer sv.mu.Unlock()
+		return sv.statuses[0].rounds > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	sv.print()
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"ACCOUNT", "CLIENT", "IP", "STATE", "ROUNDS", "FAILURES", "LAST", "CHECK", "ERROR"}, strings.Fields(lines[0]))
+		row := strings.Fields(lines[1])
+		assert.Equal(t, []string{"lab", "10.0.0.2", "online", "1", "0"}, row[:5])
+		assert.Equal(t, []string{"bad", "invalid", "0", "0", "-", "bad", "profile"}, strings.Fields(lines[2]))
+	}
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9 || js || wasip1
+
+package cmd
+
+import "errors"
+
+// addSyslogHook is unavailable on this platform
+func addSyslogHook() error {
+	return errors.New("syslog is not supported on this platform")
+}
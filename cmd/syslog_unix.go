@@ -0,0 +1,20 @@
+//go:build !windows && !plan9 && !js && !wasip1
+
+package cmd
+
+import (
+	"log/syslog"
+
+	"github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// addSyslogHook sends logs to syslog over local socket
+func addSyslogHook() error {
+	hook, err := lsyslog.NewSyslogHook("", "", syslog.LOG_INFO|syslog.LOG_DAEMON, "go-nd-portal")
+	if err != nil {
+		return err
+	}
+	logrus.AddHook(hook)
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"text/tabwriter"
+)
+
+// version is set by -ldflags "-X github.com/fumiama/go-nd-portal/cmd.version=v1.0.0",
+// or taken from build info if empty
+var version = ""
+
+// runVersion prints version, go version and platform
+func runVersion(o *options, _ []string) error {
+	v := version
+	if v == "" {
+		v = "unknown"
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			v = bi.Main.Version
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+					v += " " + s.Value[:12]
+				}
+			}
+		}
+	}
+	r := &versionResult{Version: v, Go: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	o.setResult(r, func() {
+		fmt.Println(progName, r.Version, r.Go, r.Platform)
+	})
+	return nil
+}
+
+// versionResult of version command
+type versionResult struct {
+	Version  string `json:"version"`
+	Go       string `json:"go"`
+	Platform string `json:"platform"`
+}
+
+// configFlag is a flag printed by config command
+type configFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Source is flag if set on command line, or default
+	Source string `json:"source"`
+}
+
+// configResult of config command
+type configResult struct {
+	Flags []configFlag `json:"flags"`
+}
+
+// runConfig prints flags of command in args, login by default,
+// with their effective values and whether they are set or default
+func runConfig(o *options, args []string) error {
+	c := lookupCommand("login")
+	if len(args) > 0 {
+		c = lookupCommand(args[0])
+		if c == nil {
+			return &detailError{err: errUnknownCommand, detail: args[0]}
+		}
+	}
+	set := make(map[string]bool)
+	o.flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	r := &configResult{}
+	c.flagSet(&options{}).VisitAll(func(f *flag.Flag) {
+		src, v := "default", f.DefValue
+		if pf := o.flags.Lookup(f.Name); pf != nil {
+			v = pf.Value.String()
+			if set[f.Name] {
+				src = "flag"
+			}
+		}
+		if f.Name == "p" && v != query {
+			v = "***"
+		}
+		r.Flags = append(r.Flags, configFlag{Name: f.Name, Value: v, Source: src})
+	})
+	o.setResult(r, func() {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, f := range r.Flags {
+			fmt.Fprintf(tw, "-%s\t%s\t%s\n", f.Name, f.Value, f.Source)
+		}
+		_ = tw.Flush()
+	})
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package gateway maps LAN neighbors to portal accounts
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ARPPath is the neighbor table of linux
+const ARPPath = "/proc/net/arp"
+
+// ErrIllegalRule is returned when a rule has no valid condition
+var ErrIllegalRule = errors.New("illegal gateway rule")
+
+// Neighbor is a complete entry of the neighbor table
+type Neighbor struct {
+	IP     string
+	MAC    string
+	Device string
+}
+
+// ParseARP parses the format of /proc/net/arp, skipping incomplete entries
+func ParseARP(r io.Reader) ([]Neighbor, error) {
+	var ns []Neighbor
+	sc := bufio.NewScanner(r)
+	first := true
+	for sc.Scan() {
+		if first {
+			// header
+			first = false
+			continue
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		// ATF_COM
+		if err != nil || flags&0x2 == 0 || fields[3] == "00:00:00:00:00:00" {
+			continue
+		}
+		ns = append(ns, Neighbor{IP: fields[0], MAC: strings.ToLower(fields[3]), Device: fields[5]})
+	}
+	return ns, sc.Err()
+}
+
+// ReadARP reads neighbors from file in the format of /proc/net/arp
+func ReadARP(file string) ([]Neighbor, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseARP(f)
+}
+
+// Rule maps neighbors to an account, all non-empty conditions must match
+type Rule struct {
+	MAC    string `json:"mac"`
+	CIDR   string `json:"cidr"`
+	Device string `json:"device"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Type     string `json:"type"`
+
+	prefix netip.Prefix
+}
+
+// LoadRules reads a JSON array of rules from file, first match wins
+func LoadRules(file string) ([]Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.MAC == "" && r.CIDR == "" && r.Device == "" {
+			return nil, ErrIllegalRule
+		}
+		r.MAC = strings.ToLower(r.MAC)
+		if r.CIDR != "" {
+			r.prefix, err = netip.ParsePrefix(r.CIDR)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Match reports whether n satisfies r
+func (r *Rule) Match(n Neighbor) bool {
+	if r.MAC != "" && r.MAC != n.MAC {
+		return false
+	}
+	if r.Device != "" && r.Device != n.Device {
+		return false
+	}
+	if r.CIDR != "" {
+		ip, err := netip.ParseAddr(n.IP)
+		if err != nil || !r.prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Find returns the first rule matching n, nil if none
+func Find(rules []Rule, n Neighbor) *Rule {
+	for i := range rules {
+		if rules[i].Match(n) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// Tracker diffs neighbor tables by IP
+type Tracker struct {
+	// Misses of consecutive updates before a neighbor is removed
+	Misses int
+
+	known  map[string]Neighbor
+	missed map[string]int
+}
+
+// Update takes the current table and returns new and expired neighbors.
+// A neighbor whose MAC changed is both expired and new.
+func (t *Tracker) Update(ns []Neighbor) (added, removed []Neighbor) {
+	if t.known == nil {
+		t.known = make(map[string]Neighbor)
+		t.missed = make(map[string]int)
+	}
+	seen := make(map[string]bool, len(ns))
+	for _, n := range ns {
+		seen[n.IP] = true
+		old, ok := t.known[n.IP]
+		if ok && old.MAC != n.MAC {
+			removed = append(removed, old)
+			ok = false
+		}
+		if !ok {
+			added = append(added, n)
+		}
+		t.known[n.IP] = n
+		delete(t.missed, n.IP)
+	}
+	for ip, n := range t.known {
+		if seen[ip] {
+			continue
+		}
+		t.missed[ip]++
+		if t.missed[ip] > t.Misses {
+			removed = append(removed, n)
+			delete(t.known, ip)
+			delete(t.missed, ip)
+		}
+	}
+	return
+}
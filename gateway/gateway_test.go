@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadARP(t *testing.T) {
+	ns, err := ReadARP("testdata/arp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Neighbor{
+		{IP: "192.168.1.10", MAC: "aa:bb:cc:dd:ee:01", Device: "br-lan"},
+		{IP: "192.168.1.11", MAC: "aa:bb:cc:dd:ee:02", Device: "br-lan"},
+		{IP: "10.253.0.1", MAC: "aa:bb:cc:dd:ee:ff", Device: "wan"},
+	}, ns)
+}
+
+func TestRules(t *testing.T) {
+	rules, err := LoadRules("testdata/rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := ReadARP("testdata/arp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "2000010101001", Find(rules, ns[0]).Username)
+	assert.Equal(t, "2000010101002", Find(rules, ns[1]).Username)
+	assert.Nil(t, Find(rules, ns[2]))
+}
+
+func TestTracker(t *testing.T) {
+	ns1, err := ReadARP("testdata/arp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns2, err := ReadARP("testdata/arp2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := Tracker{Misses: 1}
+	added, removed := tr.Update(ns1)
+	assert.Len(t, added, 3)
+	assert.Empty(t, removed)
+
+	added, removed = tr.Update(ns2)
+	assert.Equal(t, []Neighbor{
+		{IP: "192.168.1.11", MAC: "aa:bb:cc:dd:ee:03", Device: "br-lan"},
+		{IP: "192.168.1.13", MAC: "aa:bb:cc:dd:ee:04", Device: "br-lan"},
+	}, added)
+	// .10 missed once, kept in grace
+	assert.Equal(t, []Neighbor{{IP: "192.168.1.11", MAC: "aa:bb:cc:dd:ee:02", Device: "br-lan"}}, removed)
+
+	added, removed = tr.Update(ns2)
+	assert.Empty(t, added)
+	assert.Equal(t, []Neighbor{{IP: "192.168.1.10", MAC: "aa:bb:cc:dd:ee:01", Device: "br-lan"}}, removed)
+}
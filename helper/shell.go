@@ -0,0 +1,14 @@
+package helper
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// ShellCommand 在系统 shell 中执行命令行
+func ShellCommand(cmdline string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", cmdline)
+	}
+	return exec.Command("sh", "-c", cmdline)
+}
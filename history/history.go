@@ -0,0 +1,88 @@
+// Package history stores usage samples and reports on them
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileName of the append-only store in state dir
+const FileName = "usage.jsonl"
+
+// Sample of cumulative usage counters replied by portal
+type Sample struct {
+	Time time.Time `json:"time"`
+	// User is the account name without domain, as compared by portal
+	User    string  `json:"user"`
+	Bytes   int64   `json:"bytes"`
+	Seconds int64   `json:"seconds"`
+	Balance float64 `json:"balance"`
+}
+
+// Store is an append-only JSONL file of samples
+type Store struct {
+	path string
+}
+
+// Open returns the store in dir, creating dir if not exist
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: filepath.Join(dir, FileName)}, nil
+}
+
+// Append writes s as a line
+func (st *Store) Append(s Sample) error {
+	f, err := os.OpenFile(st.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(&s)
+}
+
+// Account strips the domain of name, so that samples recorded
+// with or without it belong to the same account
+func Account(name string) string {
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// Load reads samples of user in [from, to), all users if user is empty,
+// matching user by Account.
+// Broken lines, e.g. from a power cut during writing, are skipped.
+func (st *Store) Load(user string, from, to time.Time) ([]Sample, error) {
+	f, err := os.Open(st.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var samples []Sample
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var s Sample
+		if json.Unmarshal([]byte(line), &s) != nil {
+			continue
+		}
+		if (user != "" && Account(s.User) != Account(user)) || s.Time.Before(from) || !s.Time.Before(to) {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
@@ -0,0 +1,95 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	st, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	for i, user := range []string{"a", "a", "a@dx"} {
+		err = st.Append(Sample{Time: t0.Add(time.Duration(i) * time.Hour), User: user, Bytes: int64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = st.Append(Sample{Time: t0, User: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// simulate a torn write
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"2026-10`)
+	f.Close()
+
+	samples, err := st.Load("a", t0.Add(time.Hour), t0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []int64{1, 2}, []int64{samples[0].Bytes, samples[1].Bytes})
+	samples, err = st.Load("a@dx", t0, t0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, samples, 3)
+	samples, err = st.Load("", time.Time{}, t0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, samples, 4)
+}
+
+func TestReport(t *testing.T) {
+	loc := time.UTC
+	// 2026-10-04 is a sunday
+	samples := []Sample{
+		{Time: time.Date(2026, 10, 4, 10, 0, 0, 0, loc), Bytes: 100, Seconds: 10},
+		{Time: time.Date(2026, 10, 4, 20, 0, 0, 0, loc), Bytes: 300, Seconds: 30},
+		{Time: time.Date(2026, 10, 5, 10, 0, 0, 0, loc), Bytes: 600, Seconds: 60},
+		// counters reset
+		{Time: time.Date(2026, 10, 5, 20, 0, 0, 0, loc), Bytes: 50, Seconds: 5},
+	}
+	assert.Equal(t, []Period{
+		{Start: time.Date(2026, 10, 4, 0, 0, 0, 0, loc), Bytes: 200, Seconds: 20},
+		{Start: time.Date(2026, 10, 5, 0, 0, 0, 0, loc), Bytes: 350, Seconds: 35},
+	}, Daily(samples, loc))
+	assert.Equal(t, []Period{
+		{Start: time.Date(2026, 9, 28, 0, 0, 0, 0, loc), Bytes: 200, Seconds: 20},
+		{Start: time.Date(2026, 10, 5, 0, 0, 0, 0, loc), Bytes: 350, Seconds: 35},
+	}, Weekly(samples, loc))
+	ts := Throughputs(samples)
+	assert.Len(t, ts, 3)
+	assert.InDelta(t, 200.0/36000, ts[0].BytesPerSecond, 1e-9)
+}
+
+func TestForecast(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	var samples []Sample
+	for d := 0; d < 10; d++ {
+		samples = append(samples, Sample{Time: start.AddDate(0, 0, d), Bytes: int64(d) * 1000})
+	}
+	f, ok := Forecast(samples, start, end)
+	assert.True(t, ok)
+	assert.InDelta(t, 31000, f, 1)
+	_, ok = Forecast(samples[:1], start, end)
+	assert.False(t, ok)
+}
+
+func TestBar(t *testing.T) {
+	assert.Equal(t, "█████", Bar(50, 100, 10))
+	assert.Equal(t, "▌", Bar(5, 100, 10))
+	assert.Equal(t, "", Bar(0, 100, 10))
+}
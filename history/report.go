@@ -0,0 +1,140 @@
+package history
+
+import (
+	"strings"
+	"time"
+)
+
+// Period totals of usage
+type Period struct {
+	Start   time.Time
+	Bytes   int64
+	Seconds int64
+}
+
+// delta between two cumulative counters, which reset at cycle boundaries
+func delta(prev, cur int64) int64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return cur
+}
+
+// totals groups usage deltas of samples by start of period in loc
+func totals(samples []Sample, start func(time.Time) time.Time) []Period {
+	var periods []Period
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1], samples[i]
+		s := start(cur.Time)
+		if len(periods) == 0 || !periods[len(periods)-1].Start.Equal(s) {
+			periods = append(periods, Period{Start: s})
+		}
+		p := &periods[len(periods)-1]
+		p.Bytes += delta(prev.Bytes, cur.Bytes)
+		p.Seconds += delta(prev.Seconds, cur.Seconds)
+	}
+	return periods
+}
+
+// Daily totals of samples in loc
+func Daily(samples []Sample, loc *time.Location) []Period {
+	return totals(samples, func(t time.Time) time.Time {
+		t = t.In(loc)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	})
+}
+
+// Weekly totals of samples in loc, weeks start on monday
+func Weekly(samples []Sample, loc *time.Location) []Period {
+	return totals(samples, func(t time.Time) time.Time {
+		t = t.In(loc)
+		wd := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-wd, 0, 0, 0, 0, loc)
+	})
+}
+
+// Throughput is the average rate between two samples
+type Throughput struct {
+	From, To time.Time
+	// BytesPerSecond of wall time
+	BytesPerSecond float64
+}
+
+// Throughputs between consecutive samples
+func Throughputs(samples []Sample) []Throughput {
+	var ts []Throughput
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1], samples[i]
+		d := cur.Time.Sub(prev.Time).Seconds()
+		if d <= 0 {
+			continue
+		}
+		ts = append(ts, Throughput{
+			From:           prev.Time,
+			To:             cur.Time,
+			BytesPerSecond: float64(delta(prev.Bytes, cur.Bytes)) / d,
+		})
+	}
+	return ts
+}
+
+// Forecast fits cumulative bytes of samples since cycle start linearly by least squares
+// and returns the estimated bytes at end. It returns false with less than 2 samples.
+func Forecast(samples []Sample, start, end time.Time) (int64, bool) {
+	var (
+		n                float64
+		sx, sy, sxx, sxy float64
+		used, prev       int64
+		first            = true
+	)
+	for _, s := range samples {
+		if s.Time.Before(start) || s.Time.After(end) {
+			continue
+		}
+		if first {
+			used, first = s.Bytes, false
+		} else {
+			used += delta(prev, s.Bytes)
+		}
+		prev = s.Bytes
+		x := s.Time.Sub(start).Hours()
+		y := float64(used)
+		n++
+		sx += x
+		sy += y
+		sxx += x * x
+		sxy += x * y
+	}
+	if n < 2 {
+		return 0, false
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	k := (n*sxy - sx*sy) / den
+	b := (sy - k*sx) / n
+	y := k*end.Sub(start).Hours() + b
+	if y < float64(used) {
+		y = float64(used)
+	}
+	return int64(y), true
+}
+
+// Bar draws value of max in width cells
+func Bar(value, max int64, width int) string {
+	if max <= 0 || value <= 0 {
+		return ""
+	}
+	cells := int(value * int64(width*8) / max)
+	if cells > width*8 {
+		cells = width * 8
+	}
+	const eighths = " ▏▎▍▌▋▊▉"
+	var b strings.Builder
+	b.WriteString(strings.Repeat("█", cells/8))
+	if r := cells % 8; r > 0 {
+		b.WriteRune([]rune(eighths)[r])
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package portal
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/fumiama/go-nd-portal/helper"
+)
+
+var (
+	// ErrIllegalIPStrategy is returned when an unknown client IP strategy is provided
+	ErrIllegalIPStrategy = errors.New("illegal client ip strategy")
+	// ErrNoUsableInterfaceAddr is returned when the named interface has no usable address
+	ErrNoUsableInterfaceAddr = errors.New("no usable address on interface")
+)
+
+// IPStrategy defines known client IP discovery strategies
+type IPStrategy string
+
+const (
+	// IPStrategyChallenge uses client_ip in challenge resp
+	IPStrategyChallenge IPStrategy = "challenge"
+	// IPStrategyRoute uses the local addr of the route towards portal server
+	IPStrategyRoute IPStrategy = "route"
+	// IPStrategyInterface uses the addr of a named interface
+	IPStrategyInterface IPStrategy = "iface"
+	// IPStrategyCommand uses the output of an external command
+	IPStrategyCommand IPStrategy = "cmd"
+)
+
+// DefaultIPStrategies is used when no strategy is set
+var DefaultIPStrategies = []IPStrategy{IPStrategyChallenge, IPStrategyRoute}
+
+// ParseIPStrategies parses comma separated strategy list like "challenge,route"
+func ParseIPStrategies(s string) ([]IPStrategy, error) {
+	var strategies []IPStrategy
+	for _, name := range strings.Split(s, ",") {
+		st := IPStrategy(strings.TrimSpace(name))
+		switch st {
+		case "":
+			continue
+		case IPStrategyChallenge, IPStrategyRoute, IPStrategyInterface, IPStrategyCommand:
+			strategies = append(strategies, st)
+		default:
+			return nil, ErrIllegalIPStrategy
+		}
+	}
+	return strategies, nil
+}
+
+// ClientIPResolver resolves client IP through a chain of strategies
+type ClientIPResolver struct {
+	// Strategies in trying order, DefaultIPStrategies if empty
+	Strategies []IPStrategy
+	// Interface name for IPStrategyInterface
+	Interface string
+	// Command line for IPStrategyCommand, its stdout should be an IP
+	Command string
+}
+
+// SetClientIPResolver sets the resolver used when client IP is not specified
+func (p *Portal) SetClientIPResolver(r *ClientIPResolver) {
+	p.resolver = r
+}
+
+// resolveClientIP tries strategies in order and sets p.cip on success
+func (p *Portal) resolveClientIP(r *commonRsp) error {
+	res := p.resolver
+	if res == nil {
+		res = &ClientIPResolver{}
+	}
+	strategies := res.Strategies
+	if len(strategies) == 0 {
+		strategies = DefaultIPStrategies
+	}
+	for _, st := range strategies {
+		var (
+			cip string
+			err error
+		)
+		switch st {
+		case IPStrategyChallenge:
+			cip = r.ClientIP
+			_, err = netip.ParseAddr(cip)
+		case IPStrategyRoute:
+			cip, err = ResolveLocalClientIPTo(serverHost(p.sip))
+		case IPStrategyInterface:
+			cip, err = InterfaceClientIP(res.Interface)
+		case IPStrategyCommand:
+			cip, err = CommandClientIP(res.Command)
+		default:
+			err = ErrIllegalIPStrategy
+		}
+		if err != nil {
+			p.log().Debug("client ip strategy failed", "strategy", st, "err", err)
+			continue
+		}
+		p.cip = cip
+		p.log().Debug("client ip strategy won", "strategy", st, "ip", cip)
+		return nil
+	}
+	return ErrCannotDetermineClientIP
+}
+
+// ResolveLocalClientIPTo resolves Client IP locally by the route towards target
+func ResolveLocalClientIPTo(target string) (string, error) {
+	// Note: dialing udp sends nothing, it only looks up the route
+	conn, err := dialer.Dial("udp", net.JoinHostPort(target, "53"))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// InterfaceClientIP returns the first usable address of the named interface,
+// preferring IPv4
+func InterfaceClientIP(name string) (string, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var v6 string
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok || ipn.IP.IsLinkLocalUnicast() || ipn.IP.IsMulticast() {
+			continue
+		}
+		if ipn.IP.To4() != nil {
+			return ipn.IP.String(), nil
+		}
+		if v6 == "" {
+			v6 = ipn.IP.String()
+		}
+	}
+	if v6 != "" {
+		return v6, nil
+	}
+	return "", ErrNoUsableInterfaceAddr
+}
+
+// CommandClientIP runs command line in system shell and parses its stdout as IP
+func CommandClientIP(cmdline string) (string, error) {
+	out, err := helper.ShellCommand(cmdline).Output()
+	if err != nil {
+		return "", err
+	}
+	cip := strings.TrimSpace(helper.BytesToString(out))
+	_, err = netip.ParseAddr(cip)
+	if err != nil {
+		return "", err
+	}
+	return cip, nil
+}
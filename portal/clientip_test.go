@@ -0,0 +1,59 @@
+package portal
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPStrategies(t *testing.T) {
+	s, err := ParseIPStrategies("cmd, iface,route,challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []IPStrategy{IPStrategyCommand, IPStrategyInterface, IPStrategyRoute, IPStrategyChallenge}, s)
+
+	_, err = ParseIPStrategies("challenge,dns")
+	assert.Equal(t, ErrIllegalIPStrategy, err)
+}
+
+func TestResolveClientIPChain(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	u, err := NewPortal("2000010101001", "12345678", "", "", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetClientIPResolver(&ClientIPResolver{
+		Strategies: []IPStrategy{IPStrategyChallenge, IPStrategyInterface, IPStrategyCommand},
+		Interface:  "no-such-iface",
+		Command:    "echo 10.0.0.2",
+	})
+	err = u.resolveClientIP(&commonRsp{ClientIP: "not-an-ip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "10.0.0.2", u.cip)
+
+	u.cip = ""
+	err = u.resolveClientIP(&commonRsp{ClientIP: "10.0.0.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "10.0.0.3", u.cip)
+
+	u.cip = ""
+	u.SetClientIPResolver(&ClientIPResolver{Strategies: []IPStrategy{IPStrategyCommand}, Command: "echo nope"})
+	err = u.resolveClientIP(&commonRsp{})
+	assert.Equal(t, ErrCannotDetermineClientIP, err)
+}
+
+func TestResolveLocalClientIPTo(t *testing.T) {
+	cip, err := ResolveLocalClientIPTo("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "127.0.0.1", cip)
+}
@@ -0,0 +1,61 @@
+package portal
+
+import (
+	"sync"
+	"time"
+)
+
+// ClockSkewWarnThreshold is the offset between local and server clock to warn about
+var ClockSkewWarnThreshold = time.Minute
+
+// Clock tracks server time by its offset to local clock,
+// so that devices without RTC can login before NTP works
+type Clock struct {
+	mu     sync.RWMutex
+	offset time.Duration
+	warned bool
+}
+
+// Now returns the estimated server time
+func (c *Clock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return time.Now().Add(c.offset)
+}
+
+// Offset returns server time minus local time
+func (c *Clock) Offset() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.offset
+}
+
+// update syncs offset to server time of given precision,
+// differences within 2 precisions are ignored
+func (c *Clock) update(server time.Time, precision time.Duration, log Logger) {
+	offset := server.Sub(time.Now())
+	if offset > -2*precision && offset < 2*precision {
+		offset = 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d := offset - c.offset; d > -2*precision && d < 2*precision {
+		return
+	}
+	c.offset = offset
+	log.Debug("server clock offset", "offset", offset)
+	if !c.warned && (offset >= ClockSkewWarnThreshold || offset <= -ClockSkewWarnThreshold) {
+		c.warned = true
+		log.Warn("local clock is off from portal server, using server time instead", "off", -offset)
+	}
+}
+
+// Now returns the estimated server time of p
+func (p *Portal) Now() time.Time {
+	return p.clock.Now()
+}
+
+// Clock returns the server clock tracked by p
+func (p *Portal) Clock() *Clock {
+	return &p.clock
+}
@@ -0,0 +1,51 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockUpdate(t *testing.T) {
+	var c Clock
+	c.update(time.Now().Add(time.Second), time.Second, NopLogger)
+	assert.Equal(t, time.Duration(0), c.Offset())
+
+	c.update(time.Now().Add(-time.Hour), time.Second, NopLogger)
+	assert.InDelta(t, float64(-time.Hour), float64(c.Offset()), float64(time.Second))
+	assert.True(t, c.warned)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), c.Now(), time.Second)
+}
+
+func TestClockFromChallenge(t *testing.T) {
+	st := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	var ts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ts = append(ts, q.Get("_"))
+		w.Header().Set("Date", st.UTC().Format(http.TimeFormat))
+		_, _ = w.Write([]byte(q.Get("callback") + `({"error":"ok","challenge":"abcd","st":` + strconv.FormatInt(st.Unix(), 10) + `})`))
+	}))
+	defer srv.Close()
+
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err = u.GetChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	ms, err := strconv.ParseInt(ts[1], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.WithinDuration(t, st, time.UnixMilli(ms), 2*time.Second)
+}
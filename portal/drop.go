@@ -0,0 +1,200 @@
+package portal
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fumiama/go-nd-portal/helper"
+)
+
+var (
+	// ErrIllegalDropRule is returned when an unknown drop rule is provided
+	ErrIllegalDropRule = errors.New("illegal drop rule")
+	// ErrNoSessionToDrop is returned when drop policy finds no victim
+	ErrNoSessionToDrop = errors.New("no session can be dropped by policy")
+	// ErrUnexpectedDropResponse is returned when drop resp is shorter than expected
+	ErrUnexpectedDropResponse = errors.New("unexpected drop response")
+)
+
+// DropRule defines how to pick the session to drop
+type DropRule string
+
+const (
+	// DropRuleOldest drops the session with the earliest add_time
+	DropRuleOldest DropRule = "oldest"
+	// DropRuleIP drops the session on DropPolicy.IP
+	DropRuleIP DropRule = "ip"
+)
+
+// ParseDropRule checks s and converts it to DropRule, empty for disabled
+func ParseDropRule(s string) (DropRule, error) {
+	switch r := DropRule(s); r {
+	case "", DropRuleOldest, DropRuleIP:
+		return r, nil
+	default:
+		return "", ErrIllegalDropRule
+	}
+}
+
+// DropPolicy drops an online session and retries Login once
+// when the IP is bound to another session or the account reached its device limit
+type DropPolicy struct {
+	Rule DropRule
+	// IP for DropRuleIP
+	IP string
+	// Never drops sessions on these IPs
+	Never []string
+	// CandidateIPs to list the sessions of the account from,
+	// because portal can only query status by IP
+	CandidateIPs []string
+}
+
+// Session is an online session on an IP
+type Session struct {
+	IP       string
+	UserName string
+	AddTime  int64
+}
+
+// SetDropPolicy enables dropping sessions in Login, nil to disable
+func (p *Portal) SetDropPolicy(dp *DropPolicy) {
+	p.drop = dp
+}
+
+// Sessions lists the sessions of p's account on ips
+func (p *Portal) Sessions(ips []string) ([]Session, error) {
+	var sessions []Session
+	for _, ip := range ips {
+		s, err := p.statusOf(ip)
+		if err != nil {
+			return nil, err
+		}
+		if !s.Online() || !p.SameUser(s.UserName) {
+			continue
+		}
+		sessions = append(sessions, Session{IP: ip, UserName: s.UserName, AddTime: s.AddTime})
+	}
+	return sessions, nil
+}
+
+// victim picks the session to drop by policy on kind of login error
+func (p *Portal) victim(kind ErrorKind) (*Session, error) {
+	var sessions []Session
+	switch kind {
+	case ErrorKindIPOnline:
+		s, err := p.statusOf(p.cip)
+		if err != nil {
+			return nil, err
+		}
+		if s.Online() {
+			sessions = append(sessions, Session{IP: p.cip, UserName: s.UserName, AddTime: s.AddTime})
+		}
+	case ErrorKindDeviceLimit:
+		var err error
+		sessions, err = p.Sessions(p.drop.CandidateIPs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var v *Session
+	for i := range sessions {
+		s := &sessions[i]
+		if containsString(p.drop.Never, s.IP) {
+			continue
+		}
+		switch p.drop.Rule {
+		case DropRuleOldest:
+			if v == nil || s.AddTime < v.AddTime {
+				v = s
+			}
+		case DropRuleIP:
+			if s.IP == p.drop.IP {
+				v = s
+			}
+		default:
+			return nil, ErrIllegalDropRule
+		}
+	}
+	if v == nil {
+		return nil, ErrNoSessionToDrop
+	}
+	return v, nil
+}
+
+// DropUser forces the session of username on ip offline
+func (p *Portal) DropUser(ip, username string) error {
+	u, err := GetDropUserURL(
+		p.sip,
+		"gondportal",
+		ip,
+		username,
+		p.Now().Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	data, err := p.get(u)
+	if err != nil {
+		return err
+	}
+	p.log().Debug("get drop resp", "data", helper.BytesToString(data))
+	if len(data) < 12 {
+		return ErrUnexpectedDropResponse
+	}
+
+	var r commonRsp
+	err = json.Unmarshal(data[11:len(data)-1], &r)
+	if err != nil {
+		return err
+	}
+	return r.err(p.log())
+}
+
+// dropSign calculates sign parameter for rad_user_dm
+func dropSign(timestamp, username, ip, unbind string) string {
+	var buf [20]byte
+	h := sha1.New()
+	_, _ = h.Write(helper.StringToBytes(timestamp))
+	_, _ = h.Write(helper.StringToBytes(username))
+	_, _ = h.Write(helper.StringToBytes(ip))
+	_, _ = h.Write(helper.StringToBytes(unbind))
+	_, _ = h.Write(helper.StringToBytes(timestamp))
+	return hex.EncodeToString(h.Sum(buf[:0]))
+}
+
+// dropAndRetry drops a session by policy and logs in once more
+func (p *Portal) dropAndRetry(loginErr error) error {
+	kind := Classify(loginErr)
+	if p.drop == nil || (kind != ErrorKindIPOnline && kind != ErrorKindDeviceLimit) {
+		return loginErr
+	}
+	v, err := p.victim(kind)
+	if err != nil {
+		p.log().Warn("drop policy failed", "rule", p.drop.Rule, "kind", kind, "err", err)
+		return loginErr
+	}
+	p.log().Warn("force dropping session", "user", v.UserName, "ip", v.IP,
+		"add_time", time.Unix(v.AddTime, 0).Format(time.RFC3339), "rule", p.drop.Rule, "kind", kind)
+	err = p.DropUser(v.IP, v.UserName)
+	if err != nil {
+		return err
+	}
+	challenge, err := p.GetChallenge()
+	if err != nil {
+		return err
+	}
+	return p.login(challenge, true)
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
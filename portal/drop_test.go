@@ -0,0 +1,83 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropSign(t *testing.T) {
+	assert.Equal(t, "7d27d59bc2d9df978115d9da06503a19aa8e46b1", dropSign("1700000000", "2000010101001", "1.2.3.4", "1"))
+}
+
+func TestDropAndRetry(t *testing.T) {
+	loggedin := false
+	var dropped string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"1.2.3.4"}`
+		case "/cgi-bin/srun_portal":
+			if dropped == "" {
+				resp = `{"error":"login_error","error_msg":"E2620: You are already online.","client_ip":"1.2.3.4"}`
+			} else {
+				loggedin = true
+				resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"1.2.3.4"}`
+			}
+		case "/cgi-bin/rad_user_info":
+			switch q.Get("ip") {
+			case "10.0.0.1":
+				resp = `{"error":"ok","user_name":"2000010101001","online_ip":"10.0.0.1","add_time":1700000100}`
+			case "10.0.0.2":
+				resp = `{"error":"ok","user_name":"2000010101001","online_ip":"10.0.0.2","add_time":1700000000}`
+			case "10.0.0.3":
+				resp = `{"error":"ok","user_name":"2000010101001","online_ip":"10.0.0.3","add_time":1600000000}`
+			default:
+				resp = `{"error":"not_online_error"}`
+			}
+		case "/cgi-bin/rad_user_dm":
+			dropped = q.Get("ip")
+			resp = `{"error":"ok"}`
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := u.GetChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ErrorKindDeviceLimit, Classify(u.login(challenge, false)))
+
+	u.SetDropPolicy(&DropPolicy{
+		Rule:         DropRuleOldest,
+		Never:        []string{"10.0.0.3"},
+		CandidateIPs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+	})
+	err = u.Login(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "10.0.0.2", dropped)
+	assert.True(t, loggedin)
+}
+
+func TestParseDropRule(t *testing.T) {
+	r, err := ParseDropRule("")
+	assert.NoError(t, err)
+	assert.Equal(t, DropRule(""), r)
+	r, err = ParseDropRule("oldest")
+	assert.NoError(t, err)
+	assert.Equal(t, DropRuleOldest, r)
+	_, err = ParseDropRule("newest")
+	assert.Equal(t, ErrIllegalDropRule, err)
+}
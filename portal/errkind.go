@@ -0,0 +1,63 @@
+package portal
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrorKind classifies errors replied by portal server
+type ErrorKind string
+
+const (
+	// ErrorKindUnknown is not a known server error
+	ErrorKindUnknown ErrorKind = ""
+	// ErrorKindIPOnline means the client IP is bound to another session
+	ErrorKindIPOnline ErrorKind = "ip_online"
+	// ErrorKindDeviceLimit means the account reached its online device limit
+	ErrorKindDeviceLimit ErrorKind = "device_limit"
+	// ErrorKindArrears means the account is in arrears
+	ErrorKindArrears ErrorKind = "arrears"
+	// ErrorKindExhausted means the traffic of the account is used up
+	ErrorKindExhausted ErrorKind = "exhausted"
+	// ErrorKindLocked means the account is disabled or temporarily locked
+	ErrorKindLocked ErrorKind = "locked"
+	// ErrorKindPassword means the username or password is wrong
+	ErrorKindPassword ErrorKind = "password"
+)
+
+// errorKindKeywords maps keywords in server messages to kinds
+var errorKindKeywords = []struct {
+	keyword string
+	kind    ErrorKind
+}{
+	{"ip_already_online_error", ErrorKindIPOnline},
+	{"E2833", ErrorKindIPOnline},
+	{"E2620", ErrorKindDeviceLimit},
+	{"E2621", ErrorKindDeviceLimit},
+	{"online_num_error", ErrorKindDeviceLimit},
+	{"E2616", ErrorKindArrears},
+	{"Arrearage", ErrorKindArrears},
+	{"flux", ErrorKindExhausted},
+	{"流量", ErrorKindExhausted},
+	{"E2533", ErrorKindLocked},
+	{"E2606", ErrorKindLocked},
+	{"E2531", ErrorKindPassword},
+	{"E2553", ErrorKindPassword},
+	{"password_error", ErrorKindPassword},
+}
+
+// Classify returns the ErrorKind of err replied by portal server
+func Classify(err error) ErrorKind {
+	var cr *commonRsp
+	if !errors.As(err, &cr) {
+		return ErrorKindUnknown
+	}
+	for _, msg := range []string{cr.Status, cr.ErrorMsg, cr.PloyMsg} {
+		for _, k := range errorKindKeywords {
+			if strings.Contains(msg, k.keyword) {
+				return k.kind
+			}
+		}
+	}
+	return ErrorKindUnknown
+}
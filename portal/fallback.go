@@ -0,0 +1,197 @@
+package portal
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrNoProbeResult is returned when no login type in fallback chain can reach probe target
+var ErrNoProbeResult = errors.New("no login type can reach probe target")
+
+// DefaultFallbackOn are the error kinds to try the next login type on,
+// which are failures of the account under a login type. Network errors
+// and unclassified replies are not, as other types would fail the same.
+var DefaultFallbackOn = []ErrorKind{ErrorKindArrears, ErrorKindExhausted, ErrorKindLocked}
+
+// ParseLoginTypes parses comma separated chain like "qshd-dx,qshd-cmcc"
+func ParseLoginTypes(s string) ([]LoginType, error) {
+	var types []LoginType
+	for _, item := range strings.Split(s, ",") {
+		lt := LoginType(strings.TrimSpace(item))
+		if lt == "" {
+			continue
+		}
+		_, _, err := lt.ToDomainAcID()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, lt)
+	}
+	if len(types) == 0 {
+		return nil, ErrIllegalLoginType
+	}
+	return types, nil
+}
+
+// Fallback is a chain of login types tried in order on FallbackOn kinds
+type Fallback struct {
+	Types []LoginType
+	// On error kinds, DefaultFallbackOn if empty
+	On []ErrorKind
+	// Last login type that worked, tried first
+	Last LoginType
+	// Probe target host:port to measure RTT of each type, disabled if empty
+	Probe string
+	// RTTs to Probe measured by ProbeFallback
+	RTTs map[LoginType]time.Duration
+}
+
+// on reports whether kind is in f.On
+func (f *Fallback) on(kind ErrorKind) bool {
+	kinds := f.On
+	if len(kinds) == 0 {
+		kinds = DefaultFallbackOn
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFallback sets the chain of login types and switches p to f.Last if it is in chain
+func (p *Portal) SetFallback(f *Fallback) error {
+	p.fallback = f
+	if f == nil {
+		return nil
+	}
+	for _, lt := range f.Types {
+		if lt == f.Last && lt != p.typ {
+			return p.SetLoginType(lt)
+		}
+	}
+	return nil
+}
+
+// LoginType returns the login type in use
+func (p *Portal) LoginType() LoginType {
+	return p.typ
+}
+
+// SetLoginType switches p to lt, including server IP if it was auto selected
+func (p *Portal) SetLoginType(lt LoginType) error {
+	domain, acid, err := lt.ToDomainAcID()
+	if err != nil {
+		return err
+	}
+	if p.autosip {
+		sip, err := lt.GetDefaultPortalServerIP()
+		if err != nil {
+			return err
+		}
+		p.sip = sip
+	}
+	p.typ, p.domain, p.acid = lt, domain, acid
+	p.log().Debug("switch login type", "type", lt, "domain", domain, "ac_id", acid, "server", p.sip)
+	return nil
+}
+
+// fallbackLogin tries the other login types in chain after loginErr
+func (p *Portal) fallbackLogin(loginErr error) error {
+	f := p.fallback
+	if f == nil || !f.on(Classify(loginErr)) {
+		return loginErr
+	}
+	failed := p.typ
+	for _, lt := range f.Types {
+		if lt == failed {
+			continue
+		}
+		p.log().Warn("login type failed, fallback", "type", p.typ, "err", loginErr, "next", lt)
+		err := p.SetLoginType(lt)
+		if err != nil {
+			return err
+		}
+		err = p.loginOnce()
+		if err == nil {
+			f.Last = lt
+			return nil
+		}
+		loginErr = err
+		if !f.on(Classify(err)) {
+			return err
+		}
+	}
+	return loginErr
+}
+
+// loginOnce gets challenge and logs in without fallback
+func (p *Portal) loginOnce() error {
+	challenge, err := p.GetChallenge()
+	if err != nil {
+		return err
+	}
+	err = p.login(challenge, true)
+	if err != nil {
+		return p.dropAndRetry(err)
+	}
+	return nil
+}
+
+// MeasureRTT returns the average TCP connect time to target host:port of n tries
+func MeasureRTT(target string, n int, timeout time.Duration) (time.Duration, error) {
+	var sum time.Duration
+	for i := 0; i < n; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", target, timeout)
+		if err != nil {
+			return 0, err
+		}
+		sum += time.Since(start)
+		_ = conn.Close()
+	}
+	return sum / time.Duration(n), nil
+}
+
+// ProbeFallback logs in with each login type in chain to measure RTT to f.Probe,
+// logs out and switches p to the fastest one, which becomes f.Last.
+// It drops the current session, so call it on explicit request only.
+func (p *Portal) ProbeFallback() error {
+	f := p.fallback
+	if f == nil || f.Probe == "" {
+		return nil
+	}
+	f.RTTs = make(map[LoginType]time.Duration)
+	var best LoginType
+	for _, lt := range f.Types {
+		err := p.SetLoginType(lt)
+		if err != nil {
+			return err
+		}
+		_ = p.Logout()
+		err = p.loginOnce()
+		if err != nil {
+			p.log().Warn("probe login type login failed", "type", lt, "err", err)
+			continue
+		}
+		rtt, err := MeasureRTT(f.Probe, 3, 3*time.Second)
+		_ = p.Logout()
+		if err != nil {
+			p.log().Warn("probe login type failed", "type", lt, "err", err)
+			continue
+		}
+		p.log().Info("probe login type", "type", lt, "rtt", rtt)
+		f.RTTs[lt] = rtt
+		if best == "" || rtt < f.RTTs[best] {
+			best = lt
+		}
+	}
+	if best == "" {
+		return ErrNoProbeResult
+	}
+	f.Last = best
+	return p.SetLoginType(best)
+}
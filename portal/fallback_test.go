@@ -0,0 +1,73 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLoginTypes(t *testing.T) {
+	types, err := ParseLoginTypes("sh-dx, sh-cmcc,")
+	assert.NoError(t, err)
+	assert.Equal(t, []LoginType{LoginTypeShDX, LoginTypeShCMCC}, types)
+	_, err = ParseLoginTypes("sh-dx,nope")
+	assert.Equal(t, ErrIllegalLoginType, err)
+	_, err = ParseLoginTypes(" ")
+	assert.Equal(t, ErrIllegalLoginType, err)
+}
+
+func TestFallbackLogin(t *testing.T) {
+	var logins []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"1.2.3.4"}`
+		case "/cgi-bin/srun_portal":
+			logins = append(logins, q.Get("username"))
+			switch {
+			case strings.HasSuffix(q.Get("username"), "@dx"):
+				resp = `{"error":"login_error","error_msg":"E2616: Arrearage users.","client_ip":"1.2.3.4"}`
+			case strings.HasSuffix(q.Get("username"), "@uestc"):
+				resp = `{"error":"login_error","error_msg":"E2531: User not found.","client_ip":"1.2.3.4"}`
+			default:
+				resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"1.2.3.4"}`
+			}
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	p, err := NewPortal("a", "1", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Fallback{Types: []LoginType{LoginTypeShDX, LoginTypeShCMCC}}
+	assert.NoError(t, p.SetFallback(f))
+	ch, err := p.GetChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, p.Login(ch))
+	assert.Equal(t, []string{"a@dx", "a@cmccgx"}, logins)
+	assert.Equal(t, LoginTypeShCMCC, f.Last)
+	assert.Equal(t, LoginTypeShCMCC, p.LoginType())
+
+	// last worked type is tried first
+	logins = nil
+	p, _ = NewPortal("a", "1", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShDX)
+	assert.NoError(t, p.SetFallback(f))
+	assert.Equal(t, LoginTypeShCMCC, p.LoginType())
+
+	// password errors do not fall back
+	logins = nil
+	p, _ = NewPortal("a", "1", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShEdu)
+	assert.NoError(t, p.SetFallback(&Fallback{Types: []LoginType{LoginTypeShEdu, LoginTypeShCMCC}}))
+	ch, _ = p.GetChallenge()
+	assert.Equal(t, ErrorKindPassword, Classify(p.Login(ch)))
+	assert.Equal(t, []string{"a@uestc"}, logins)
+}
@@ -0,0 +1,84 @@
+package portal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/fumiama/go-nd-portal/helper"
+)
+
+// ErrBodyTooLarge is returned when response body exceeds MaxBodySize of HTTPOptions
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// snippetSize is the max length of body kept in StatusError
+const snippetSize = 256
+
+// RedirectError is returned when server redirects to another host,
+// e.g. to a captive page, or redirects too many times
+type RedirectError struct {
+	StatusCode int
+	Location   string
+}
+
+// Error implements the error interface for RedirectError
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("status code: %d, redirected to: %s", e.StatusCode, e.Location)
+}
+
+// StatusError is returned when server replies a non-200 status
+type StatusError struct {
+	StatusCode int
+	// Body snippet with secrets redacted
+	Body string
+}
+
+// Error implements the error interface for StatusError
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// redactor masks values of some keys in query strings and JSON
+type redactor []*regexp.Regexp
+
+// newRedactor of keys in regexp alternation like "password|info"
+func newRedactor(keys string) redactor {
+	return redactor{
+		regexp.MustCompile(`(?i)("(?:` + keys + `)"\s*:\s*")([^"]*)`),
+		regexp.MustCompile(`(?i)((?:^|[?&])(?:` + keys + `)=)([^&\s]*)`),
+	}
+}
+
+// redact masks values of keys in s
+func (r redactor) redact(s string) string {
+	for _, re := range r {
+		s = re.ReplaceAllString(s, "${1}***")
+	}
+	return s
+}
+
+// secrets redactor for logs and errors
+var secrets = newRedactor("password|info|chksum|challenge|token")
+
+// Redact masks values of password, info, chksum, challenge
+// and token in query strings and JSON of s
+func Redact(s string) string {
+	return secrets.redact(s)
+}
+
+// snippet returns head of redacted body
+func snippet(body []byte) string {
+	s := Redact(helper.BytesToString(body))
+	if len(s) > snippetSize {
+		s = s[:snippetSize]
+		// dont cut a rune in half
+		for i := 0; i < utf8.UTFMax-1 && !utf8.ValidString(s); i++ {
+			s = s[:len(s)-1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package portal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrIllegalUserInfo is returned when info cannot be decoded with challenge
+	ErrIllegalUserInfo = errors.New("illegal encoded user info")
+	// ErrUnknownPortalURL is returned when inspected URL is not srun_portal or get_challenge
+	ErrUnknownPortalURL = errors.New("not a srun_portal or get_challenge URL")
+)
+
+// FieldDiff is a field of captured request differing from what portal generates
+type FieldDiff struct {
+	Field    string
+	Captured string
+	Expected string
+}
+
+// Inspection of a captured request URL
+type Inspection struct {
+	// CGI is get_challenge or srun_portal
+	CGI       string
+	Challenge *GetChallengeReq
+	Portal    *GetPortalReq
+	// UserInfo decrypted from info of Portal, nil without challenge
+	UserInfo *UserInfo
+	Diffs    []FieldDiff
+}
+
+// Inspect parses captured get_challenge or srun_portal URL u.
+// For srun_portal it decrypts info with challenge, recomputes HMAC, info and chksum
+// with password, taken from info if empty, and reports differing fields.
+// Timestamps are never compared.
+func Inspect(u, challenge, password string) (*Inspection, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	q := pu.Query()
+	ins := &Inspection{CGI: path.Base(pu.Path)}
+	switch ins.CGI {
+	case "get_challenge":
+		ins.Challenge = &GetChallengeReq{}
+		err = decodeQuery(q, ins.Challenge)
+		if err != nil {
+			return nil, err
+		}
+		ins.diff("callback", ins.Challenge.Callback, "gondportal")
+		return ins, nil
+	case "srun_portal":
+		ins.Portal = &GetPortalReq{}
+		err = decodeQuery(q, ins.Portal)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownPortalURL
+	}
+
+	r := ins.Portal
+	ins.diff("callback", r.Callback, "gondportal")
+	ins.diff("action", r.Action, "login")
+	ins.diff("n", r.ConstantN, "200")
+	ins.diff("type", r.ConstantType, "1")
+	ins.diff("os", r.OS, "Windows 10")
+	ins.diff("name", r.Platform, "Windows")
+	ins.diff("double_stack", r.DoubleStack, "0")
+	if challenge == "" {
+		return ins, nil
+	}
+
+	info := strings.TrimPrefix(r.EncodedUserInfo, "{SRBX1}")
+	dec, err := DecodeUserInfo(info, challenge)
+	if err == nil {
+		var ui UserInfo
+		err = json.Unmarshal([]byte(dec), &ui)
+		if err == nil {
+			ins.UserInfo = &ui
+		}
+	}
+	if err != nil {
+		ins.diff("info", r.EncodedUserInfo, "{SRBX1}...")
+	} else {
+		ins.diff("info.username", ins.UserInfo.Username, r.Username)
+		ins.diff("info.ip", ins.UserInfo.IP, r.IP)
+		ins.diff("info.acid", ins.UserInfo.AcID, r.AcID)
+		ins.diff("info.enc_ver", ins.UserInfo.EncVer, "srun_bx1")
+		if password == "" {
+			password = ins.UserInfo.Password
+		} else {
+			ins.diff("info.password", ins.UserInfo.Password, password)
+		}
+	}
+	if password == "" {
+		return ins, nil
+	}
+
+	p := &Portal{pswd: Secret(password)}
+	hmd5 := p.PasswordHMd5(challenge)
+	ins.diff("password", r.EncryptedPassword, "{MD5}"+hmd5)
+	userInfo, err := GetUserInfo(r.Username, "", password, r.IP, r.AcID)
+	if err != nil {
+		return nil, err
+	}
+	ins.diff("info", r.EncodedUserInfo, "{SRBX1}"+EncodeUserInfo(userInfo, challenge))
+	// chksum is recomputed from captured fields to tell its own error apart
+	ins.diff("chksum", r.Checksum, p.CheckSum(
+		challenge, r.Username, "", strings.TrimPrefix(r.EncryptedPassword, "{MD5}"),
+		r.AcID, r.IP, info,
+	))
+	return ins, nil
+}
+
+// diff records field if captured differs from expected
+func (ins *Inspection) diff(field, captured, expected string) {
+	if captured != expected {
+		ins.Diffs = append(ins.Diffs, FieldDiff{Field: field, Captured: captured, Expected: expected})
+	}
+}
+
+// decodeQuery fills string and int64 fields of struct pointed by v by their url tags
+func decodeQuery(q url.Values, v any) error {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("url"), ",")
+		s := q.Get(name)
+		switch f := rv.Field(i); f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Int64:
+			if s == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return err
+			}
+			f.SetInt(n)
+		}
+	}
+	return nil
+}
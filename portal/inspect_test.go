@@ -0,0 +1,66 @@
+package portal
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeUserInfo(t *testing.T) {
+	info := `{"username":"2001010101001@dx-uestc","password":"1234567890","ip":"113.54.148.243","acid":"1","enc_ver":"srun_bx1"}`
+	challenge := "d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e"
+	dec, err := DecodeUserInfo("CfVnZ9mvKmdgvm/ivovlPibZL6RLAWcx+nBTaYmWH3kmThco+eO4LVsCPFceSmM9PyI0UcMgLE7bmpfY9pr0EWnWdTncXrbW29Aydp+lw6QjxKMgNzgYd7uopiPbIyKpxvJZDHsGw5xh8rMEeq3JXrD2vex27xeI", challenge)
+	assert.NoError(t, err)
+	assert.Equal(t, info, dec)
+	dec, err = DecodeUserInfo(EncodeUserInfo("abc", "abcd"), "abcd")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", dec)
+	_, err = DecodeUserInfo("!!", challenge)
+	assert.Equal(t, ErrIllegalUserInfo, err)
+}
+
+func TestInspect(t *testing.T) {
+	challenge := "d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e"
+	p, err := NewPortal("2001010101001", "1234567890", "", "113.54.148.243", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lu, err := p.LoginURL(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins, err := Inspect(lu, challenge, "1234567890")
+	assert.NoError(t, err)
+	assert.Equal(t, "srun_portal", ins.CGI)
+	assert.Equal(t, "2001010101001@dx-uestc", ins.Portal.Username)
+	assert.Equal(t, "1234567890", ins.UserInfo.Password)
+	assert.Empty(t, ins.Diffs)
+
+	// password taken from info
+	ins, err = Inspect(lu, challenge, "")
+	assert.NoError(t, err)
+	assert.Empty(t, ins.Diffs)
+
+	u, _ := url.Parse(lu)
+	q := u.Query()
+	q.Set("chksum", "0000")
+	q.Set("callback", "jQuery123")
+	u.RawQuery = q.Encode()
+	ins, err = Inspect(u.String(), challenge, "wrong")
+	assert.NoError(t, err)
+	var fields []string
+	for _, d := range ins.Diffs {
+		fields = append(fields, d.Field)
+	}
+	assert.Equal(t, []string{"callback", "info.password", "password", "info", "chksum"}, fields)
+
+	cu, _ := p.ChallengeURL()
+	ins, err = Inspect(cu, "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "113.54.148.243", ins.Challenge.IP)
+	assert.Empty(t, ins.Diffs)
+
+	_, err = Inspect("http://10.253.0.237/cgi-bin/rad_user_info", "", "")
+	assert.Equal(t, ErrUnknownPortalURL, err)
+}
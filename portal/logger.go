@@ -0,0 +1,100 @@
+package portal
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger receives logs of a Portal as a message with alternating key-value pairs,
+// which *slog.Logger satisfies
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+}
+
+// nopLogger discards all logs
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+
+// NopLogger discards all logs, the default of Portal
+var NopLogger Logger = nopLogger{}
+
+// SetLogger routes logs of p to l, discarding them if l is nil
+func (p *Portal) SetLogger(l Logger) {
+	p.logger = l
+}
+
+// log returns the logger of p with secrets redacted
+func (p *Portal) log() Logger {
+	return redactLogger(p.logger)
+}
+
+// redacting masks secrets in message and string values
+type redacting struct {
+	l Logger
+}
+
+// redactLogger wraps l by redacting, NopLogger if l is nil
+func redactLogger(l Logger) Logger {
+	switch l.(type) {
+	case nil:
+		return NopLogger
+	case nopLogger, redacting:
+		return l
+	}
+	return redacting{l}
+}
+
+// redactArgs masks secrets in values of args that print as text,
+// such as errors of requests carrying the login URL
+func redactArgs(args []any) []any {
+	out := make([]any, len(args))
+	for i, a := range args {
+		if i%2 == 1 {
+			switch v := a.(type) {
+			case string:
+				a = Redact(v)
+			case error, fmt.Stringer:
+				a = Redact(fmt.Sprint(v))
+			}
+		}
+		out[i] = a
+	}
+	return out
+}
+
+func (r redacting) Debug(msg string, args ...any) { r.l.Debug(Redact(msg), redactArgs(args)...) }
+func (r redacting) Info(msg string, args ...any)  { r.l.Info(Redact(msg), redactArgs(args)...) }
+func (r redacting) Warn(msg string, args ...any)  { r.l.Warn(Redact(msg), redactArgs(args)...) }
+
+// logrusLogger adapts logrus to Logger
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+// NewLogrusLogger adapts l to Logger, key-value pairs become fields
+func NewLogrusLogger(l logrus.FieldLogger) Logger {
+	return logrusLogger{l: l}
+}
+
+// fields converts alternating key-value pairs, a dangling value is keyed !BADKEY like slog
+func fields(args []any) logrus.Fields {
+	f := make(logrus.Fields, len(args)/2+1)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			f["!BADKEY"] = args[i]
+			break
+		}
+		f[fmt.Sprint(args[i])] = args[i+1]
+	}
+	return f
+}
+
+func (g logrusLogger) Debug(msg string, args ...any) { g.l.WithFields(fields(args)).Debug(msg) }
+func (g logrusLogger) Info(msg string, args ...any)  { g.l.WithFields(fields(args)).Info(msg) }
+func (g logrusLogger) Warn(msg string, args ...any)  { g.l.WithFields(fields(args)).Warn(msg) }
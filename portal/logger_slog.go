@@ -0,0 +1,13 @@
+//go:build go1.21
+
+package portal
+
+import "log/slog"
+
+// NewSlogLogger adapts l to Logger, slog.Default() if l is nil
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
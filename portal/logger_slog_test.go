@@ -0,0 +1,30 @@
+//go:build go1.21
+
+package portal
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	p, err := NewPortal("a", "1", "", "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetLogger(NewSlogLogger(l))
+	p.log().Warn("use portal server", "server", "10.253.0.237", "url", "http://a/?password=x&n=1")
+	assert.Equal(t, "level=WARN msg=\"use portal server\" server=10.253.0.237 url=\"http://a/?password=***&n=1\"\n", buf.String())
+}
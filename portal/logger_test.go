@@ -0,0 +1,47 @@
+package portal
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogrusLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	NewLogrusLogger(l).Warn("portal server failed", "server", "10.253.0.237", "streak", 2, "dangling")
+	assert.Equal(t, "level=warning msg=\"portal server failed\" !BADKEY=dangling server=10.253.0.237 streak=2\n", buf.String())
+}
+
+func TestDefaultNop(t *testing.T) {
+	p, err := NewPortal("a", "1", "", "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NopLogger, p.log())
+	p.SetLogger(NopLogger)
+	assert.Equal(t, NopLogger, p.log())
+}
+
+func TestRedactError(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	err := &url.Error{
+		Op:  "Get",
+		URL: "http://10.253.0.237/cgi-bin/srun_portal?password={MD5}c0433&info={SRBX1}abc&chksum=def",
+		Err: errors.New("EOF"),
+	}
+	redactLogger(NewLogrusLogger(l)).Warn("login failed", "err", err)
+	assert.NotContains(t, buf.String(), "c0433")
+	assert.NotContains(t, buf.String(), "SRBX1")
+	assert.NotContains(t, buf.String(), "def")
+	assert.Contains(t, buf.String(), "password=***")
+}
@@ -0,0 +1,107 @@
+package portal
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// ErrIllegalMismatchPolicy is returned when an unknown mismatch policy is provided
+var ErrIllegalMismatchPolicy = errors.New("illegal client ip mismatch policy")
+
+// MismatchPolicy defines how to handle client IP in login req
+// that differs from the one seen by server
+type MismatchPolicy string
+
+const (
+	// MismatchPolicyWarn only logs a warning
+	MismatchPolicyWarn MismatchPolicy = "warn"
+	// MismatchPolicyStrict fails with *IPMismatchError
+	MismatchPolicyStrict MismatchPolicy = "strict"
+	// MismatchPolicyAdopt redoes challenge and login with the IP seen by server
+	MismatchPolicyAdopt MismatchPolicy = "adopt"
+)
+
+// ParseMismatchPolicy checks s and converts it to MismatchPolicy, empty for warn
+func ParseMismatchPolicy(s string) (MismatchPolicy, error) {
+	switch mp := MismatchPolicy(s); mp {
+	case "":
+		return MismatchPolicyWarn, nil
+	case MismatchPolicyWarn, MismatchPolicyStrict, MismatchPolicyAdopt:
+		return mp, nil
+	default:
+		return "", ErrIllegalMismatchPolicy
+	}
+}
+
+// IPMismatchError is returned by strict policy
+type IPMismatchError struct {
+	// Requested IP in login req
+	Requested string
+	// Seen IP by server in login resp
+	Seen string
+	// NAT is true if Seen is not on any local interface
+	NAT bool
+}
+
+// Error implements the error interface for IPMismatchError
+func (e *IPMismatchError) Error() string {
+	msg := "client ip mismatch, request: " + e.Requested + ", server seen: " + e.Seen
+	if e.NAT {
+		msg += ", probably behind NAT"
+	}
+	return msg
+}
+
+// SetMismatchPolicy sets how to handle client IP mismatch in Login
+func (p *Portal) SetMismatchPolicy(mp MismatchPolicy) {
+	p.mismatch = mp
+}
+
+// IsLocalIP reports whether ip is on any local interface
+func IsLocalIP(ip string) (bool, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, err
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false, err
+	}
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		la, ok := netip.AddrFromSlice(ipn.IP)
+		if ok && la.Unmap() == addr.Unmap() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkMismatch handles seen client IP by mismatch policy.
+// It returns true if login should be redone with the adopted IP.
+func (p *Portal) checkMismatch(seen string, adopt bool) (bool, error) {
+	if seen == "" || p.cip == seen {
+		return false, nil
+	}
+	e := &IPMismatchError{Requested: p.cip, Seen: seen}
+	local, err := IsLocalIP(seen)
+	if err == nil {
+		e.NAT = !local
+	}
+	switch p.mismatch {
+	case MismatchPolicyStrict:
+		return false, e
+	case MismatchPolicyAdopt:
+		if adopt {
+			p.log().Warn("adopt server seen ip and login again", "err", e)
+			p.cip = seen
+			return true, nil
+		}
+	}
+	p.log().Warn("client ip in login request does not match response! unexpected errors may occur", "err", e)
+	return false, nil
+}
@@ -0,0 +1,56 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLocalIP(t *testing.T) {
+	local, err := IsLocalIP("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, local)
+	local, err = IsLocalIP("192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, local)
+}
+
+func TestMismatchPolicy(t *testing.T) {
+	var loginIPs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"192.0.2.1"}`
+		case "/cgi-bin/srun_portal":
+			loginIPs = append(loginIPs, q.Get("ip"))
+			resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"192.0.2.1"}`
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetMismatchPolicy(MismatchPolicyStrict)
+	err = u.Login("d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e")
+	assert.Equal(t, &IPMismatchError{Requested: "1.2.3.4", Seen: "192.0.2.1", NAT: true}, err)
+
+	loginIPs = nil
+	u.SetMismatchPolicy(MismatchPolicyAdopt)
+	err = u.Login("d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"1.2.3.4", "192.0.2.1"}, loginIPs)
+}
@@ -0,0 +1,136 @@
+package portal
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+// AddrPollInterval is the interval of polling interfaces when netlink is unavailable
+var AddrPollInterval = 10 * time.Second
+
+// WatchAddrChange notifies possible local address changes until ctx is done,
+// using netlink address notifications on linux and falling back to polling
+func (p *Portal) WatchAddrChange(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	go func() {
+		err := watchNetlink(ctx, ch)
+		if err != nil && ctx.Err() == nil {
+			p.log().Debug("netlink unavailable, fallback to polling interfaces", "err", err)
+			pollAddrs(ctx, ch)
+		}
+	}()
+	return ch
+}
+
+// notify sends to ch without blocking, merging pending notifications
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// pollAddrs compares local addresses every AddrPollInterval
+func pollAddrs(ctx context.Context, ch chan<- struct{}) {
+	last := localAddrs()
+	t := time.NewTicker(AddrPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			addrs := localAddrs()
+			if addrs != last {
+				last = addrs
+				notify(ch)
+			}
+		}
+	}
+}
+
+// localAddrs returns all local addresses as a string
+func localAddrs() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, a := range addrs {
+		b.WriteString(a.String())
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// LocalClientIP resolves client IP by local strategies in resolver,
+// route is used if there is none
+func (p *Portal) LocalClientIP() (string, error) {
+	res := ClientIPResolver{}
+	if p.resolver != nil {
+		res = *p.resolver
+	}
+	var strategies []IPStrategy
+	for _, st := range res.Strategies {
+		if st != IPStrategyChallenge {
+			strategies = append(strategies, st)
+		}
+	}
+	if len(strategies) == 0 {
+		strategies = []IPStrategy{IPStrategyRoute}
+	}
+	res.Strategies = strategies
+	q := Portal{sip: p.sip, resolver: &res}
+	err := q.resolveClientIP(&commonRsp{})
+	if err != nil {
+		return "", err
+	}
+	return q.cip, nil
+}
+
+// WaitLocalClientIP waits until LocalClientIP succeeds or ctx is done
+func (p *Portal) WaitLocalClientIP(ctx context.Context) (string, error) {
+	ch := p.WatchAddrChange(ctx)
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		cip, err := p.LocalClientIP()
+		if err == nil {
+			return cip, nil
+		}
+		p.log().Debug("waiting for local client ip", "err", err)
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-ch:
+		case <-t.C:
+		}
+	}
+}
+
+// ClientIP returns the client IP in use, empty if not determined yet
+func (p *Portal) ClientIP() string {
+	return p.cip
+}
+
+// OnlineIP returns online_ip in the last login resp, or status resp if already online
+func (p *Portal) OnlineIP() string {
+	return p.oip
+}
+
+// UserName returns the username without domain
+func (p *Portal) UserName() string {
+	return p.name
+}
+
+// Server returns the portal server in use
+func (p *Portal) Server() string {
+	return p.sip
+}
+
+// SetClientIP changes the client IP for later requests
+func (p *Portal) SetClientIP(cip string) {
+	p.cip = cip
+}
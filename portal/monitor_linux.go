@@ -0,0 +1,56 @@
+package portal
+
+import (
+	"context"
+	"syscall"
+)
+
+// netlink multicast groups, missing in syscall
+const (
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// watchNetlink notifies ch on netlink address and route changes
+func watchNetlink(ctx context.Context, ch chan<- struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr | rtmgrpIPv4Route,
+	})
+	if err != nil {
+		return err
+	}
+	// wake up every second to check ctx
+	tv := syscall.Timeval{Sec: 1}
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for ctx.Err() == nil {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+			return err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.RTM_NEWADDR, syscall.RTM_DELADDR, syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+				notify(ch)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package portal
+
+import (
+	"context"
+	"errors"
+)
+
+// watchNetlink is only available on linux
+func watchNetlink(_ context.Context, _ chan<- struct{}) error {
+	return errors.New("netlink is not supported on this platform")
+}
@@ -0,0 +1,51 @@
+package portal
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalClientIP(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	u, err := NewPortal("2000010101001", "12345678", "127.0.0.1", "", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cip, err := u.LocalClientIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "127.0.0.1", cip)
+
+	u.SetClientIPResolver(&ClientIPResolver{
+		Strategies: []IPStrategy{IPStrategyChallenge, IPStrategyCommand},
+		Command:    "echo 10.0.0.2",
+	})
+	cip, err = u.LocalClientIP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "10.0.0.2", cip)
+	assert.Equal(t, "", u.ClientIP())
+}
+
+func TestWaitLocalClientIPTimeout(t *testing.T) {
+	u, err := NewPortal("2000010101001", "12345678", "127.0.0.1", "", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetClientIPResolver(&ClientIPResolver{
+		Strategies: []IPStrategy{IPStrategyInterface},
+		Interface:  "no-such-iface",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = u.WaitLocalClientIP(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package portal
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPoolExhausted is returned when every account in pool failed or is cooling down
+var ErrPoolExhausted = errors.New("no account in pool can login")
+
+// DefaultRotateOn are the error kinds to rotate accounts on
+var DefaultRotateOn = []ErrorKind{ErrorKindArrears, ErrorKindExhausted, ErrorKindLocked}
+
+// Credential of one account in pool
+type Credential struct {
+	Username string
+	Password string
+	// Type of login, qsh-edu if empty
+	Type LoginType
+}
+
+// key of c in Pool.Cooldowns, as the same account may cool down under one type only
+func (c Credential) key() string {
+	return string(c.Type) + "/" + c.Username
+}
+
+// Pool rotates through accounts in order when one can not login
+type Pool struct {
+	Credentials []Credential
+	// RotateOn error kinds, DefaultRotateOn if empty
+	RotateOn []ErrorKind
+	// New creates the Portal of c
+	New func(c Credential) (*Portal, error)
+	// ResetAt returns when an account failed of kind at now can be tried again
+	ResetAt func(kind ErrorKind, now time.Time) time.Time
+	// Cooldowns maps type/username to the time it can be tried again
+	Cooldowns map[string]time.Time
+	// Log of pool, discarded if nil
+	Log Logger
+	// Now returns the time to check cooldowns by,
+	// the server time of the active account if nil
+	Now func() time.Time
+
+	// current is the index of the account to try
+	current int
+	// active is the portal of account at activeIdx
+	active    *Portal
+	activeIdx int
+}
+
+// Active returns the portal of the account in use, nil if none yet
+func (pl *Pool) Active() *Portal {
+	return pl.active
+}
+
+// now returns the time to check cooldowns by, local time before any account is used
+func (pl *Pool) now() time.Time {
+	switch {
+	case pl.Now != nil:
+		return pl.Now()
+	case pl.active != nil:
+		return pl.active.Now()
+	}
+	return time.Now()
+}
+
+// setDefaults fills empty types of credentials and cooldowns map
+func (pl *Pool) setDefaults() {
+	for i := range pl.Credentials {
+		if pl.Credentials[i].Type == "" {
+			pl.Credentials[i].Type = LoginTypeQshEdu
+		}
+	}
+	if pl.Cooldowns == nil {
+		pl.Cooldowns = make(map[string]time.Time)
+	}
+}
+
+// Current returns the portal of the account to try, creating it if needed
+func (pl *Pool) Current() (*Portal, error) {
+	if len(pl.Credentials) == 0 {
+		return nil, ErrPoolExhausted
+	}
+	pl.setDefaults()
+	if pl.active == nil || pl.activeIdx != pl.current {
+		if pl.active != nil {
+			err := pl.active.Logout()
+			if err != nil {
+				redactLogger(pl.Log).Warn("logout previous account failed", "user", pl.active.name, "err", err)
+			}
+		}
+		p, err := pl.New(pl.Credentials[pl.current])
+		if err != nil {
+			return nil, err
+		}
+		pl.active, pl.activeIdx = p, pl.current
+		redactLogger(pl.Log).Info("using account in pool", "user", pl.Credentials[pl.current].Username)
+	}
+	return pl.active, nil
+}
+
+// rotateOn reports whether kind is in pl.RotateOn
+func (pl *Pool) rotateOn(kind ErrorKind) bool {
+	kinds := pl.RotateOn
+	if len(kinds) == 0 {
+		kinds = DefaultRotateOn
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Keep keeps one account of pool online, starting from the one in use.
+// An account failed of RotateOn kinds cools down until ResetAt,
+// and the previous account is logged out before trying the next one.
+func (pl *Pool) Keep() (*Portal, error) {
+	pl.setDefaults()
+	for tried := 0; tried < len(pl.Credentials); tried++ {
+		c := pl.Credentials[pl.current]
+		if until, ok := pl.Cooldowns[c.key()]; ok {
+			if pl.now().Before(until) {
+				redactLogger(pl.Log).Debug("account is cooling down", "user", c.Username, "until", until)
+				pl.current = (pl.current + 1) % len(pl.Credentials)
+				continue
+			}
+			delete(pl.Cooldowns, c.key())
+		}
+		p, err := pl.Current()
+		if err != nil {
+			return nil, err
+		}
+		err = p.keep()
+		if err == nil {
+			return p, nil
+		}
+		kind := Classify(err)
+		if !pl.rotateOn(kind) {
+			return p, err
+		}
+		// server time is known after the failed request
+		now := pl.now()
+		until := now.Add(time.Hour)
+		if pl.ResetAt != nil {
+			until = pl.ResetAt(kind, now)
+		}
+		pl.Cooldowns[c.key()] = until
+		redactLogger(pl.Log).Warn("account failed, cooling down", "user", c.Username, "kind", kind, "err", err, "until", until)
+		pl.current = (pl.current + 1) % len(pl.Credentials)
+	}
+	return nil, ErrPoolExhausted
+}
+
+// keep logs in if p is not online yet
+func (p *Portal) keep() error {
+	online, err := p.IsOnline()
+	if err != nil || online {
+		return err
+	}
+	challenge, err := p.GetChallenge()
+	if err != nil {
+		return err
+	}
+	return p.Login(challenge)
+}
@@ -0,0 +1,122 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, ErrorKindArrears, Classify(&commonRsp{Status: "login_error", ErrorMsg: "E2616: Arrearage users."}))
+	assert.Equal(t, ErrorKindIPOnline, Classify(&commonRsp{Status: "ip_already_online_error"}))
+	assert.Equal(t, ErrorKindUnknown, Classify(ErrUnexpectedLoginResponse))
+}
+
+func TestPoolRotate(t *testing.T) {
+	var actions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"1.2.3.4"}`
+		case "/cgi-bin/rad_user_info":
+			resp = `{"error":"not_online_error"}`
+		case "/cgi-bin/srun_portal":
+			actions = append(actions, q.Get("action")+" "+q.Get("username"))
+			switch {
+			case q.Get("action") == "logout":
+				resp = `{"error":"ok","suc_msg":"logout_ok"}`
+			case strings.HasPrefix(q.Get("username"), "a@"):
+				resp = `{"error":"login_error","error_msg":"E2616: Arrearage users.","client_ip":"1.2.3.4"}`
+			default:
+				resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"1.2.3.4"}`
+			}
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	reset := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+	pl := &Pool{
+		Credentials: []Credential{{Username: "a", Password: "1"}, {Username: "b", Password: "2"}},
+		New: func(c Credential) (*Portal, error) {
+			return NewPortal(c.Username, c.Password, strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShEdu)
+		},
+		ResetAt: func(kind ErrorKind, now time.Time) time.Time {
+			assert.Equal(t, ErrorKindArrears, kind)
+			return reset
+		},
+	}
+	p, err := pl.Keep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "b", p.name)
+	assert.Equal(t, []string{"login a@uestc", "logout a@uestc", "login b@uestc"}, actions)
+	assert.Equal(t, map[string]time.Time{"qsh-edu/a": reset}, pl.Cooldowns)
+
+	// a is still cooling down
+	pl.current = 0
+	_, err = pl.Keep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "b", pl.Active().name)
+
+	// a is tried again after cooldown by the clock of pool
+	actions = nil
+	pl.Now = func() time.Time { return reset }
+	pl.current = 0
+	_, err = pl.Keep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"logout b@uestc", "login a@uestc", "logout a@uestc", "login b@uestc"}, actions)
+}
+
+func TestPoolCooldownByType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var resp string
+		switch r.URL.Path {
+		case "/cgi-bin/get_challenge":
+			resp = `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"1.2.3.4"}`
+		case "/cgi-bin/rad_user_info":
+			resp = `{"error":"not_online_error"}`
+		case "/cgi-bin/srun_portal":
+			switch {
+			case q.Get("action") == "logout":
+				resp = `{"error":"ok","suc_msg":"logout_ok"}`
+			case q.Get("username") == "a@uestc":
+				resp = `{"error":"login_error","error_msg":"E2616: Arrearage users.","client_ip":"1.2.3.4"}`
+			default:
+				resp = `{"error":"ok","suc_msg":"login_ok","client_ip":"1.2.3.4"}`
+			}
+		}
+		_, _ = w.Write([]byte(q.Get("callback") + "(" + resp + ")"))
+	}))
+	defer srv.Close()
+
+	reset := time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
+	pl := &Pool{
+		// same account under two types, empty type is qsh-edu
+		Credentials: []Credential{{Username: "a", Password: "1", Type: LoginTypeShEdu}, {Username: "a", Password: "1"}},
+		New: func(c Credential) (*Portal, error) {
+			return NewPortal(c.Username, c.Password, strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", c.Type)
+		},
+		ResetAt: func(ErrorKind, time.Time) time.Time {
+			return reset
+		},
+	}
+	p, err := pl.Keep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, LoginTypeQshEdu, p.LoginType())
+	assert.Equal(t, map[string]time.Time{"sh-edu/a": reset}, pl.Cooldowns)
+}
@@ -7,12 +7,9 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"net"
-	"net/netip"
+	"net/http"
 	"time"
 
-	"github.com/sirupsen/logrus"
-
 	"github.com/fumiama/go-nd-portal/helper"
 )
 
@@ -30,11 +27,25 @@ var (
 // Portal struct for login config
 type Portal struct {
 	name   string
-	pswd   string
+	pswd   Secret
 	cip    string
+	oip    string
 	sip    string
 	domain string
 	acid   string
+
+	typ     LoginType
+	autosip bool
+	// csip is the server configured on creation, empty if autosip
+	csip     string
+	resolver *ClientIPResolver
+	drop     *DropPolicy
+	mismatch MismatchPolicy
+	clock    Clock
+	limiter  *RateLimiter
+	fallback *Fallback
+	servers  *Servers
+	logger   Logger
 }
 
 // LoginType defines known login types
@@ -57,6 +68,12 @@ const (
 	LoginTypeShCMCC LoginType = "sh-cmcc"
 )
 
+// LoginTypes are all known login types
+var LoginTypes = []LoginType{
+	LoginTypeQshEdu, LoginTypeQshDX, LoginTypeQshDormDX, LoginTypeQshDormCMCC,
+	LoginTypeShEdu, LoginTypeShDX, LoginTypeShCMCC,
+}
+
 // GetDefaultPortalServerIP returns default PortalServerIP by LoginType
 func (lt LoginType) GetDefaultPortalServerIP() (string, error) {
 	var sIP string
@@ -115,13 +132,7 @@ func (lt LoginType) ToDomainAcID() (string, string, error) {
 
 // ResolveLocalClientIP resolves Client IP locally
 func ResolveLocalClientIP() (string, error) {
-	conn, err := net.Dial("udp", "8.8.8.8:53")
-	if err != nil {
-		return "", err
-	}
-	defer conn.Close()
-
-	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+	return ResolveLocalClientIPTo("8.8.8.8")
 }
 
 // commonRsp struct for login session specific response
@@ -134,11 +145,13 @@ type commonRsp struct {
 	SuccessMsg string `json:"suc_msg"`
 
 	// client_ip
-	ClientIP   string `json:"client_ip"`
+	ClientIP string `json:"client_ip"`
 	// online_ip
-	OnlineIP   string `json:"online_ip"`
+	OnlineIP string `json:"online_ip"`
 	// challenge
-	Challenge  string `json:"challenge"`
+	Challenge string `json:"challenge"`
+	// server unix time in seconds
+	ServerTime int64 `json:"st"`
 }
 
 // Error implements the error interface for commonRsp
@@ -154,11 +167,11 @@ func (cr *commonRsp) Error() string {
 }
 
 // err checks if the response indicates an error
-func (cr *commonRsp) err() error {
+func (cr *commonRsp) err(log Logger) error {
 	if cr.Status == "ok" {
-		// if suc_msg is not login_ok, warn
-		if cr.SuccessMsg != "" && cr.SuccessMsg != "login_ok" {
-			logrus.Warnln("server response:", cr.SuccessMsg)
+		// if suc_msg is not login_ok or logout_ok, warn
+		if cr.SuccessMsg != "" && cr.SuccessMsg != "login_ok" && cr.SuccessMsg != "logout_ok" {
+			log.Warn("unexpected server response", "suc_msg", cr.SuccessMsg)
 		}
 		return nil
 	}
@@ -172,57 +185,49 @@ func NewPortal(name, password, sIP string, cIP string, loginType LoginType) (*Po
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("login type: %s, portal domain: %s, ac_id: %s", loginType, domain, acid)
 
-	if sIP == "" {
+	autosip, csip := sIP == "", sIP
+	if autosip {
 		sIP, err = loginType.GetDefaultPortalServerIP()
 		if err != nil {
 			return nil, err
 		}
 	}
-	logrus.Debugf("server addr: %s", sIP)
 
 	return &Portal{
-		name:   name,
-		pswd:   password,
-		cip:    cIP,
-		sip:    sIP,
-		domain: domain,
-		acid:   acid,
+		name:    name,
+		pswd:    Secret(password),
+		cip:     cIP,
+		sip:     sIP,
+		domain:  domain,
+		acid:    acid,
+		typ:     loginType,
+		autosip: autosip,
+		csip:    csip,
 	}, nil
 }
 
-// GetChallenge gets token for encryption from server
+// GetChallenge gets token for encryption from server,
+// picking the server by failover or racing if servers are set
 func (p *Portal) GetChallenge() (string, error) {
-	// Note: no need to do URL encoding here
-	u, err := GetChallengeURL(
-		p.sip,
-		"gondportal",
-		p.name,
-		p.domain,
-		p.cip,
-		time.Now().UnixMilli(),
+	var (
+		r      *commonRsp
+		header http.Header
+		err    error
 	)
-
-	if err != nil {
-		return "", err
+	if p.servers != nil {
+		r, header, err = p.pickServer()
+	} else {
+		r, header, err = p.challenge(p.sip)
 	}
-	logrus.Debugln("GET", u)
-	data, err := requestDataWith(u, "GET", PortalHeaderUA)
+	p.syncClock(header)
 	if err != nil {
 		return "", err
 	}
-	logrus.Debugln("get challenge resp:", helper.BytesToString(data))
-	if len(data) < 12 {
-		return "", ErrUnexpectedChallengeResponse
-	}
-
-	var r commonRsp
-	err = json.Unmarshal(data[11:len(data)-1], &r)
-	if err != nil {
-		return "", err
+	if r.ServerTime > 0 {
+		p.clock.update(time.Unix(r.ServerTime, 0), time.Second, p.log())
 	}
-	err = r.err()
+	err = r.err(p.log())
 	// rsp message handling
 	if err != nil {
 		return "", err
@@ -230,44 +235,67 @@ func (p *Portal) GetChallenge() (string, error) {
 
 	// if cip was left empty, try get from challenge resp
 	if p.cip == "" {
-		logrus.Debugln("client ip is not specified, try get client ip from challenge resp")
-		_, err = netip.ParseAddr(r.ClientIP)
-		if err == nil {
-			p.cip = r.ClientIP
-			logrus.Debugln("get client ip from challenge resp:", r.ClientIP)
-		} else {
-			// if ClientIP is invalid, try resolve it locally
-			p.cip, err = ResolveLocalClientIP()
-			if err != nil {
-				return "", ErrCannotDetermineClientIP
-			}
-			logrus.Debugln("failed to get client ip from challenge resp, using locally resolved ip:", p.cip)
+		p.log().Debug("client ip is not specified, try resolve it by strategies")
+		err = p.resolveClientIP(r)
+		if err != nil {
+			return "", err
 		}
 	}
-	logrus.Debugln("get challenge:", r.Challenge)
+	p.log().Debug("get challenge", "length", len(r.Challenge))
 	return r.Challenge, nil
 }
 
-// PasswordHMd5 encrypts password with hmacmd5 algorithm
-func (p *Portal) PasswordHMd5(challenge string) string {
-	var buf [16]byte
-	h := hmac.New(md5.New, helper.StringToBytes(challenge))
-	_, _ = h.Write(helper.StringToBytes(p.pswd))
-	return hex.EncodeToString(h.Sum(buf[:0]))
+// challenge requests challenge from server sip without modifying p
+func (p *Portal) challenge(sip string) (*commonRsp, http.Header, error) {
+	u, err := p.challengeURL(sip)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, header, err := p.fetch(u)
+	if err != nil {
+		return nil, header, err
+	}
+	p.log().Debug("get challenge resp", "data", helper.BytesToString(data))
+	if len(data) < 12 {
+		return nil, header, ErrUnexpectedChallengeResponse
+	}
+
+	var r commonRsp
+	err = json.Unmarshal(data[11:len(data)-1], &r)
+	if err != nil {
+		return nil, header, err
+	}
+	return &r, header, nil
 }
 
-// Login sends login request to server
-// input:
-// challenge
-func (p *Portal) Login(challenge string) error {
-	userInfo, err := GetUserInfo(p.name, p.domain, p.pswd, p.cip, p.acid)
+// ChallengeURL returns the get_challenge URL of current server
+func (p *Portal) ChallengeURL() (string, error) {
+	return p.challengeURL(p.sip)
+}
+
+// challengeURL returns the get_challenge URL of server sip
+func (p *Portal) challengeURL(sip string) (string, error) {
+	// Note: no need to do URL encoding here
+	return GetChallengeURL(
+		sip,
+		"gondportal",
+		p.name,
+		p.domain,
+		p.cip,
+		p.Now().UnixMilli(),
+	)
+}
+
+// LoginURL returns the srun_portal login URL with info and chksum computed from challenge
+func (p *Portal) LoginURL(challenge string) (string, error) {
+	userInfo, err := GetUserInfo(p.name, p.domain, p.pswd.Reveal(), p.cip, p.acid)
 	if err != nil {
-		return err
+		return "", err
 	}
 	info := EncodeUserInfo(userInfo, challenge)
 	hmd5 := p.PasswordHMd5(challenge)
 	// Note: no need to do URL encoding here
-	u, err := GetLoginURL(
+	return GetLoginURL(
 		p.sip,
 		"gondportal",
 		p.name,
@@ -277,18 +305,49 @@ func (p *Portal) Login(challenge string) error {
 		p.cip,
 		p.CheckSum(challenge, p.name, p.domain, hmd5, p.acid, p.cip, info),
 		info,
-		time.Now().UnixMilli(),
+		p.Now().UnixMilli(),
 	)
+}
 
+// PasswordHMd5 encrypts password with hmacmd5 algorithm
+func (p *Portal) PasswordHMd5(challenge string) string {
+	var buf [16]byte
+	h := hmac.New(md5.New, helper.StringToBytes(challenge))
+	_, _ = h.Write(p.pswd)
+	return hex.EncodeToString(h.Sum(buf[:0]))
+}
+
+// Login sends login request to server,
+// dropping a session and retrying once by drop policy if set,
+// then trying other login types by fallback chain if set
+// input:
+// challenge
+func (p *Portal) Login(challenge string) error {
+	err := p.login(challenge, true)
+	if err != nil {
+		err = p.dropAndRetry(err)
+	}
+	if err != nil {
+		return p.fallbackLogin(err)
+	}
+	if p.fallback != nil {
+		p.fallback.Last = p.typ
+	}
+	return nil
+}
+
+// login sends login request to server once,
+// and once more if adopt and mismatch policy adopts server seen IP
+func (p *Portal) login(challenge string, adopt bool) error {
+	u, err := p.LoginURL(challenge)
 	if err != nil {
 		return err
 	}
-	logrus.Debugln("GET", u)
-	data, err := requestDataWith(u, "GET", PortalHeaderUA)
+	data, err := p.get(u)
 	if err != nil {
 		return err
 	}
-	logrus.Debugln("get login resp:", helper.BytesToString(data))
+	p.log().Debug("get login resp", "data", helper.BytesToString(data))
 	if len(data) < 12 {
 		return ErrUnexpectedLoginResponse
 	}
@@ -298,12 +357,20 @@ func (p *Portal) Login(challenge string) error {
 	if err != nil {
 		return err
 	}
+	p.oip = r.OnlineIP
 
 	// compare local cip with response client_ip
-	if p.cip != r.ClientIP {
-		logrus.Warnln("client ip in login request does not match response! unexpected errors may occur")
-		logrus.Warnf("request: %s, response: %s", p.cip, r.ClientIP)
+	redo, err := p.checkMismatch(r.ClientIP, adopt)
+	if err != nil {
+		return err
+	}
+	if redo {
+		challenge, err = p.GetChallenge()
+		if err != nil {
+			return err
+		}
+		return p.login(challenge, false)
 	}
 
-	return r.err()
+	return r.err(p.log())
 }
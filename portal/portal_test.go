@@ -36,3 +36,19 @@ func TestResolveLocalClientIP(t *testing.T) {
 	}
 	t.Log(cip)
 }
+
+func TestLoginURL(t *testing.T) {
+	u, err := NewPortal("2000010101001", "12345678", "10.253.0.237:8080", "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lu, err := u.LoginURL("abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, lu, "http://10.253.0.237:8080/cgi-bin/srun_portal?")
+	assert.Contains(t, Redact(lu), "&chksum=***&")
+	assert.Contains(t, Redact(lu), "&info=***&")
+	assert.Contains(t, Redact(lu), "&password=***&")
+	assert.NotContains(t, Redact(lu), u.PasswordHMd5("abcd"))
+}
@@ -0,0 +1,36 @@
+package portal
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests to portal servers, it can be shared by Portals
+type RateLimiter struct {
+	mu    sync.Mutex
+	every time.Duration
+	next  time.Time
+}
+
+// NewRateLimiter allows one request every interval
+func NewRateLimiter(every time.Duration) *RateLimiter {
+	return &RateLimiter{every: every}
+}
+
+// Wait blocks until the next request is allowed
+func (r *RateLimiter) Wait() {
+	r.mu.Lock()
+	now := time.Now()
+	at := r.next
+	if at.Before(now) {
+		at = now
+	}
+	r.next = at.Add(r.every)
+	r.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// SetRateLimiter sets the limiter of requests of p, nil to disable
+func (p *Portal) SetRateLimiter(r *RateLimiter) {
+	p.limiter = r
+}
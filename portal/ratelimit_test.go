@@ -0,0 +1,24 @@
+package portal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	r := NewRateLimiter(20 * time.Millisecond)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Wait()
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+}
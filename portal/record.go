@@ -0,0 +1,282 @@
+package portal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoRecordedExchange is returned by Replayer when no recorded exchange is left for a request
+var ErrNoRecordedExchange = errors.New("no recorded exchange left for request")
+
+// exchangeSecrets are redacted from recordings, keeping challenge to replay
+var exchangeSecrets = newRedactor("password|info|chksum")
+
+// Recording is a HAR-like log of HTTP exchanges with portal servers
+type Recording struct {
+	Log RecordingLog `json:"log"`
+}
+
+// RecordingLog is the log object of HAR
+type RecordingLog struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator of recording
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Entry is one exchange
+type Entry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	// Time in milliseconds
+	Time     float64         `json:"time"`
+	Request  RecordedRequest `json:"request"`
+	Response RecordedReply   `json:"response"`
+	// Error of transport if no response
+	Error string `json:"_error,omitempty"`
+}
+
+// NameValue is a header
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// RecordedRequest is the request of an entry with secrets redacted
+type RecordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers []NameValue `json:"headers"`
+}
+
+// RecordedReply is the response of an entry with secrets redacted
+type RecordedReply struct {
+	Status     int         `json:"status"`
+	StatusText string      `json:"statusText"`
+	Headers    []NameValue `json:"headers"`
+	Content    Content     `json:"content"`
+}
+
+// Content of response
+type Content struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// headers converts h to HAR name-value list
+func headers(h http.Header) []NameValue {
+	nvs := make([]NameValue, 0, len(h))
+	for k, vs := range h {
+		for _, v := range vs {
+			nvs = append(nvs, NameValue{Name: k, Value: v})
+		}
+	}
+	return nvs
+}
+
+// Recorder is a http.RoundTripper writing each exchange through Transport into Path
+// with password, HMAC and info redacted
+type Recorder struct {
+	// Transport to record, portal transport if nil
+	Transport http.RoundTripper
+	// Path of the recording, appended after each exchange
+	Path string
+	// Log receives errors of writing Path, discarded if nil
+	Log Logger
+
+	mu sync.Mutex
+	f  *os.File
+	// end is the offset of recordingTail in f
+	end int64
+}
+
+// recordingHead and recordingTail enclose entries written by Recorder
+const (
+	recordingHead = `{"log":{"version":"1.2","creator":{"name":"go-nd-portal","version":"1"},"entries":[`
+	recordingTail = "\n]}}\n"
+)
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := r.Transport
+	if rt == nil {
+		rt = transport
+	}
+	e := Entry{
+		StartedDateTime: time.Now(),
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     exchangeSecrets.redact(req.URL.String()),
+			Headers: headers(req.Header),
+		},
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		e.Time = float64(time.Since(e.StartedDateTime).Microseconds()) / 1000
+		e.Error = err.Error()
+		r.add(e)
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, httpOptions.MaxBodySize+1))
+	_ = resp.Body.Close()
+	e.Time = float64(time.Since(e.StartedDateTime).Microseconds()) / 1000
+	if err != nil {
+		e.Error = err.Error()
+		r.add(e)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	e.Response = RecordedReply{
+		Status:     resp.StatusCode,
+		StatusText: http.StatusText(resp.StatusCode),
+		Headers:    headers(resp.Header),
+		Content: Content{
+			Size:     len(body),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     exchangeSecrets.redact(string(body)),
+		},
+	}
+	r.add(e)
+	return resp, nil
+}
+
+// add appends e to recording in place of its tail, so that the file stays valid JSON.
+// Errors are logged instead of failing the exchange, which has been done.
+func (r *Recorder) add(e Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.write(e)
+	if err != nil {
+		redactLogger(r.Log).Warn("write recording failed", "path", r.Path, "err", err)
+	}
+}
+
+// write e at r.end, creating the file on first entry
+func (r *Recorder) write(e Entry) error {
+	data, err := json.MarshalIndent(&e, "    ", "  ")
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	f := r.f
+	if f == nil {
+		f, err = os.OpenFile(r.Path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(recordingHead)
+	} else {
+		buf.WriteByte(',')
+	}
+	buf.WriteString("\n    ")
+	buf.Write(data)
+	n := int64(buf.Len())
+	buf.WriteString(recordingTail)
+	_, err = f.WriteAt(buf.Bytes(), r.end)
+	if err != nil {
+		if r.f == nil {
+			// head is not written, retry from scratch on next entry
+			_ = f.Close()
+		}
+		return err
+	}
+	r.f = f
+	r.end += n
+	return nil
+}
+
+// Close closes the recording file, later exchanges start it over
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f, r.end = nil, 0
+	return err
+}
+
+// LoadRecording reads recording written by Recorder
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec Recording
+	err = json.Unmarshal(data, &rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// Replayer is a http.RoundTripper serving recorded exchanges in order,
+// matching requests by method and path as timestamps differ in queries
+type Replayer struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewReplayer serves entries of rec
+func NewReplayer(rec *Recording) *Replayer {
+	return &Replayer{entries: append([]Entry(nil), rec.Log.Entries...)}
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, e := range r.entries {
+		if e.Request.Method != req.Method || !samePath(e.Request.URL, req.URL.Path) {
+			continue
+		}
+		r.entries = append(r.entries[:i], r.entries[i+1:]...)
+		if e.Error != "" {
+			return nil, errors.New(e.Error)
+		}
+		h := make(http.Header, len(e.Response.Headers))
+		for _, nv := range e.Response.Headers {
+			h.Add(nv.Name, nv.Value)
+		}
+		return &http.Response{
+			Status:        e.Response.StatusText,
+			StatusCode:    e.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        h,
+			Body:          io.NopCloser(bytes.NewReader([]byte(e.Response.Content.Text))),
+			ContentLength: int64(len(e.Response.Content.Text)),
+			Request:       req,
+		}, nil
+	}
+	return nil, ErrNoRecordedExchange
+}
+
+// samePath reports whether recorded URL u has path
+func samePath(u, path string) bool {
+	ru, err := url.Parse(u)
+	return err == nil && ru.Path == path
+}
+
+// SetRoundTripper sends requests to portal servers through rt,
+// such as a Recorder or Replayer, default transport if rt is nil
+func SetRoundTripper(rt http.RoundTripper) {
+	if rt == nil {
+		rt = transport
+	}
+	client.Transport = rt
+}
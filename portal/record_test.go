@@ -0,0 +1,71 @@
+package portal
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/cgi-bin/get_challenge": `{"error":"ok","challenge":"d26466d4036507dadb17e87e23358126e0210cb289d19151f59bcfcefdcf345e","client_ip":"1.2.3.4"}`,
+		"/cgi-bin/srun_portal":   `{"error":"login_error","error_msg":"E2616: Arrearage users.","client_ip":"1.2.3.4"}`,
+	})
+	defer SetRoundTripper(nil)
+	path := filepath.Join(t.TempDir(), "portal.har")
+
+	login := func() error {
+		p, err := NewPortal("a", "secret", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShEdu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := p.GetChallenge()
+		if err != nil {
+			return err
+		}
+		return p.Login(ch)
+	}
+	SetRoundTripper(&Recorder{Path: path})
+	recorded := login()
+	assert.Equal(t, ErrorKindArrears, Classify(recorded))
+	srv.Close()
+
+	rec, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rec.Log.Entries, 2)
+	lu := rec.Log.Entries[1].Request.URL
+	assert.Contains(t, lu, "password=***")
+	assert.Contains(t, lu, "info=***")
+	assert.Contains(t, lu, "chksum=***")
+	assert.Equal(t, http.StatusOK, rec.Log.Entries[1].Response.Status)
+
+	// server is gone, replay the failure offline
+	SetRoundTripper(NewReplayer(rec))
+	assert.Equal(t, recorded.Error(), login().Error())
+	_, _, err = requestDataWith(srv.URL+"/cgi-bin/srun_portal", "GET", "")
+	assert.ErrorIs(t, err, ErrNoRecordedExchange)
+}
+
+func TestRecorderWriteError(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/cgi-bin/get_challenge": `{"error":"ok","challenge":"abc","client_ip":"1.2.3.4"}`,
+	})
+	defer srv.Close()
+	defer SetRoundTripper(nil)
+	// failing to write recording does not fail the exchange
+	rec := &Recorder{Path: filepath.Join(t.TempDir(), "missing", "portal.har")}
+	SetRoundTripper(rec)
+	p, err := NewPortal("a", "1", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeShEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := p.GetChallenge()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", ch)
+	assert.NoError(t, rec.Close())
+}
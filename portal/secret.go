@@ -0,0 +1,46 @@
+package portal
+
+import "fmt"
+
+// Secret bytes like password, printed as *** by fmt, logs and JSON.
+//
+// Clearing it is best effort: each login builds info by GetUserInfo
+// from a string copy by Reveal, and strings cannot be zeroed,
+// so copies live on in memory until collected.
+type Secret []byte
+
+// masked is how a Secret prints
+const masked = "***"
+
+// String implements fmt.Stringer
+func (Secret) String() string {
+	return masked
+}
+
+// Format implements fmt.Formatter for all verbs including %#v
+func (Secret) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(masked))
+}
+
+// MarshalJSON implements json.Marshaler
+func (Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + masked + `"`), nil
+}
+
+// Reveal returns a string copy of s
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+// Clear zeros s in place
+func (s Secret) Clear() {
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+// Clear zeros the password of p in memory, p cannot login anymore.
+// String copies made by earlier logins are not reached, see Secret.
+func (p *Portal) Clear() {
+	p.pswd.Clear()
+}
@@ -0,0 +1,48 @@
+package portal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecret(t *testing.T) {
+	s := Secret("12345678")
+	for _, f := range []string{"%v", "%s", "%q", "%x", "%#v", "%+v"} {
+		assert.Equal(t, "***", fmt.Sprintf(f, s), f)
+	}
+	assert.Equal(t, "{***}", fmt.Sprintf("%v", struct{ P Secret }{s}))
+	data, err := json.Marshal(struct{ P Secret }{s})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"P":"***"}`, string(data))
+	assert.Equal(t, "12345678", s.Reveal())
+	s.Clear()
+	assert.Equal(t, make([]byte, 8), []byte(s))
+}
+
+func TestLogRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetLevel(logrus.DebugLevel)
+	p, err := NewPortal("2001010101001", "1234567890", "", "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetLogger(NewLogrusLogger(l))
+	lu, err := p.LoginURL("abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.log().Debug("GET", "url", lu)
+	p.log().Debug("resp: "+`{"challenge":"abcd","error":"ok"}`, "n", 1)
+	assert.NotContains(t, buf.String(), p.PasswordHMd5("abcd"))
+	assert.NotContains(t, buf.String(), "abcd")
+	assert.Contains(t, buf.String(), "password=***")
+	p.Clear()
+	assert.Equal(t, make([]byte, 10), []byte(p.pswd))
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/google/go-querystring/query"
@@ -36,8 +37,8 @@ const (
 	PortalDomainShCMCC = "@cmccgx"
 
 	// PortalGetChallenge GetChallenge URL
-	PortalGetChallenge = "http://%v/cgi-bin/get_challenge?%s"
-	// 1.server IP
+	PortalGetChallenge = "%s/cgi-bin/get_challenge?%s"
+	// 1.server base URL
 	// 2.callback
 	// 3.username 4.PortalDomain
 	// 5.client IP
@@ -52,9 +53,9 @@ const (
 	AcIDSh = "6"
 
 	// PortalCGI Auth CGI URL
-	PortalCGI = "http://%v/cgi-bin/srun_portal?%s"
+	PortalCGI = "%s/cgi-bin/srun_portal?%s"
 	// qsh LoginURL key-value order
-	// 1.server IP
+	// 1.server base URL
 	// 2.callback
 	// 3.username 4.PortalDomain
 	// 5.encrypted password
@@ -64,6 +65,24 @@ const (
 	// 9.info
 	// 10.timestamp
 	// PortalLogin			= "http://%v/cgi-bin/srun_portal?callback=%s&action=login&username=%s%s&password={MD5}%s&ac_id=%s&ip=%v&chksum=%s&info={SRBX1}%s&n=200&type=1&os=Windows+10&name=Windows&double_stack=0&_=%d"
+	// PortalLogout		= "http://%v/cgi-bin/srun_portal?callback=%s&action=logout&username=%s%s&ac_id=%s&ip=%v&_=%d"
+
+	// PortalUserInfo online status URL
+	PortalUserInfo = "%s/cgi-bin/rad_user_info?%s"
+	// 1.server base URL
+	// 2.callback
+	// 3.client IP, omitted to query the IP seen by server
+	// 4.timestamp
+
+	// PortalDropUser drop user URL
+	PortalDropUser = "%s/cgi-bin/rad_user_dm?%s"
+	// 1.server base URL
+	// 2.callback
+	// 3.IP of the session
+	// 4.username of the session
+	// 5.unix time in seconds
+	// 6.unbind: always 1
+	// 7.sign: sha1(time + username + ip + unbind + time)
 )
 
 // GetChallengeReq struct for GetChallenge URL query
@@ -92,6 +111,33 @@ type GetPortalReq struct {
 	Timestamp         int64  `url:"_"`
 }
 
+// GetLogoutReq struct for Portal Auth CGI URL logout query
+type GetLogoutReq struct {
+	Callback  string `url:"callback"`
+	Action    string `url:"action"`
+	Username  string `url:"username"`
+	AcID      string `url:"ac_id"`
+	IP        string `url:"ip"`
+	Timestamp int64  `url:"_"`
+}
+
+// GetUserStatusReq struct for online status URL query
+type GetUserStatusReq struct {
+	Callback  string `url:"callback"`
+	IP        string `url:"ip,omitempty"`
+	Timestamp int64  `url:"_"`
+}
+
+// GetDropUserReq struct for drop user URL query
+type GetDropUserReq struct {
+	Callback string `url:"callback"`
+	IP       string `url:"ip"`
+	Username string `url:"username"`
+	Time     int64  `url:"time"`
+	Unbind   string `url:"unbind"`
+	Sign     string `url:"sign"`
+}
+
 // GetChallengeURL generates the URL for getchallenge req
 func GetChallengeURL(
 	sIP,
@@ -109,7 +155,11 @@ func GetChallengeURL(
 		return "", err
 	}
 
-	return fmt.Sprintf(PortalGetChallenge, sIP, v.Encode()), nil
+	base, err := ServerBaseURL(sIP)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(PortalGetChallenge, base, v.Encode()), nil
 }
 
 // GetLoginURL generates the URL for login req
@@ -143,7 +193,87 @@ func GetLoginURL(
 		return "", err
 	}
 
-	return fmt.Sprintf(PortalCGI, sIP, v.Encode()), nil
+	base, err := ServerBaseURL(sIP)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(PortalCGI, base, v.Encode()), nil
+}
+
+// GetLogoutURL generates the URL for logout req
+func GetLogoutURL(
+	sIP,
+	callback,
+	username, domain,
+	acid,
+	cIP string,
+	timestamp int64) (string, error) {
+	v, err := query.Values(&GetLogoutReq{
+		Callback:  callback,
+		Action:    "logout",
+		Username:  username + domain,
+		AcID:      acid,
+		IP:        cIP,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	base, err := ServerBaseURL(sIP)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(PortalCGI, base, v.Encode()), nil
+}
+
+// GetUserStatusURL generates the URL for online status req
+func GetUserStatusURL(
+	sIP,
+	callback,
+	cIP string,
+	timestamp int64) (string, error) {
+	v, err := query.Values(&GetUserStatusReq{
+		Callback:  callback,
+		IP:        cIP,
+		Timestamp: timestamp,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	base, err := ServerBaseURL(sIP)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(PortalUserInfo, base, v.Encode()), nil
+}
+
+// GetDropUserURL generates the URL for drop user req
+func GetDropUserURL(
+	sIP,
+	callback,
+	ip,
+	username string,
+	timestamp int64) (string, error) {
+	t := strconv.FormatInt(timestamp, 10)
+	v, err := query.Values(&GetDropUserReq{
+		Callback: callback,
+		IP:       ip,
+		Username: username,
+		Time:     timestamp,
+		Unbind:   "1",
+		Sign:     dropSign(t, username, ip, "1"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	base, err := ServerBaseURL(sIP)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(PortalDropUser, base, v.Encode()), nil
 }
 
 const (
@@ -199,13 +329,17 @@ func EncodeUserInfo(info, challenge string) string {
 	for i := 0; i < sc/4; i++ {
 		v[i] = binary.LittleEndian.Uint32(userinfo[i*4 : i*4+4])
 	}
+	// info holds plaintext password
+	Secret(userinfo).Clear()
 	v = append(v, uint32(len(info)))
 	sc = len(challenge)
 	if sc < 16 {
 		sc = 16
 	}
 	k := make([]uint32, sc/4)
-	token := helper.StringToBytes(challenge)
+	// short challenge is padded by zeros
+	token := make([]byte, sc)
+	copy(token, challenge)
 	for i := 0; i < sc/4; i++ {
 		k[i] = binary.LittleEndian.Uint32(token[i*4 : i*4+4])
 	}
@@ -237,6 +371,65 @@ func EncodeUserInfo(info, challenge string) string {
 	return base64.Base64Encoding.EncodeToString(lv)
 }
 
+// DecodeUserInfo decodes info encoded by EncodeUserInfo with challenge,
+// without {SRBX1} prefix
+func DecodeUserInfo(info, challenge string) (string, error) {
+	if len(challenge) == 0 || len(challenge)%4 != 0 {
+		return "", ErrIllegalUserInfo
+	}
+	lv, err := base64.Base64Encoding.DecodeString(info)
+	if err != nil || len(lv) < 8 || len(lv)%4 != 0 {
+		return "", ErrIllegalUserInfo
+	}
+	v := make([]uint32, len(lv)/4)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(lv[i*4 : i*4+4])
+	}
+	sc := len(challenge)
+	if sc < 16 {
+		sc = 16
+	}
+	k := make([]uint32, sc/4)
+	// short challenge is padded by zeros
+	token := make([]byte, sc)
+	copy(token, challenge)
+	for i := 0; i < sc/4; i++ {
+		k[i] = binary.LittleEndian.Uint32(token[i*4 : i*4+4])
+	}
+	n := len(v) - 1
+	rounds := 6 + 52/(n+1)
+	const delta = uint32(0x86014019|0x183639A0) & uint32(0x8CE0D9BF|0x731F2640)
+	d := uint32(rounds) * delta
+	// mx is the same mixing as in EncodeUserInfo
+	mx := func(y, z uint32, p int, e uint32) uint32 {
+		m := (z >> 5) ^ (y << 2)
+		m += ((y >> 3) ^ (z << 4)) ^ (d ^ y)
+		m += k[(uint32(p)&3)^e] ^ z
+		return m
+	}
+	for q := 0; q < rounds; q++ {
+		e := (d >> 2) & 3
+		v[n] -= mx(v[0], v[n-1], n, e)
+		for p := n - 1; p >= 0; p-- {
+			z := v[n]
+			if p > 0 {
+				z = v[p-1]
+			}
+			v[p] -= mx(v[p+1], z, p, e)
+		}
+		d -= delta
+	}
+	size := int(v[n])
+	if size > n*4 {
+		return "", ErrIllegalUserInfo
+	}
+	b := make([]byte, n*4)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint32(b[i*4:i*4+4], v[i])
+	}
+	return string(b[:size]), nil
+}
+
 // CheckSum calculates chksum parameter for login
 func (p *Portal) CheckSum(
 	challenge,
@@ -16,7 +16,7 @@ func TestGetUserInfo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	info, err := GetUserInfo(u.name, u.domain, u.pswd, u.cip, u.acid)
+	info, err := GetUserInfo(u.name, u.domain, u.pswd.Reveal(), u.cip, u.acid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -56,7 +56,7 @@ func TestEncodeUserInfo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	info, err := GetUserInfo(u.name, u.domain, u.pswd, u.cip, u.acid)
+	info, err := GetUserInfo(u.name, u.domain, u.pswd.Reveal(), u.cip, u.acid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -84,7 +84,7 @@ func TestCheckSum(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	info, err := GetUserInfo(u.name, u.domain, u.pswd, u.cip, u.acid)
+	info, err := GetUserInfo(u.name, u.domain, u.pswd.Reveal(), u.cip, u.acid)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,225 @@
+package portal
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrIllegalServerMode is returned when an unknown server mode is provided
+var ErrIllegalServerMode = errors.New("illegal server mode")
+
+// ServerMode decides how to pick a server from Servers
+type ServerMode string
+
+const (
+	// ServerModeFailover tries servers one by one, last worked and healthy ones first
+	ServerModeFailover ServerMode = "failover"
+	// ServerModeRace requests challenge from all servers at once and uses the first responder
+	ServerModeRace ServerMode = "race"
+)
+
+// ParseServerMode checks s and converts it to ServerMode, empty for failover
+func ParseServerMode(s string) (ServerMode, error) {
+	switch m := ServerMode(s); m {
+	case "":
+		return ServerModeFailover, nil
+	case ServerModeFailover, ServerModeRace:
+		return m, nil
+	default:
+		return "", ErrIllegalServerMode
+	}
+}
+
+// BuiltinServers are known portal servers by login type
+var BuiltinServers = map[LoginType][]string{
+	LoginTypeQshEdu:      {PortalServerIPQsh},
+	LoginTypeQshDX:       {PortalServerIPQsh},
+	LoginTypeQshDormDX:   {PortalServerIPQshDorm},
+	LoginTypeQshDormCMCC: {PortalServerIPQshDorm},
+	LoginTypeShEdu:       {PortalServerIPSh},
+	LoginTypeShDX:        {PortalServerIPSh},
+	LoginTypeShCMCC:      {PortalServerIPSh},
+}
+
+// ServerHealth of a portal server
+type ServerHealth struct {
+	OK   int `json:"ok"`
+	Fail int `json:"fail"`
+	// Streak of consecutive failures
+	Streak    int           `json:"streak"`
+	RTT       time.Duration `json:"rtt"`
+	LastOK    time.Time     `json:"last_ok,omitempty"`
+	LastError string        `json:"last_error,omitempty"`
+}
+
+// ServersState is the persistable part of Servers
+type ServersState struct {
+	// Last server that worked by login type
+	Last   map[LoginType]string     `json:"last"`
+	Health map[string]*ServerHealth `json:"health"`
+}
+
+// Servers to fail over or race between, safe to share among portals
+type Servers struct {
+	// Extra servers by login type appended to built-in ones, for all types under empty key
+	Extra map[LoginType][]string
+	Mode  ServerMode
+
+	mu     sync.Mutex
+	last   map[LoginType]string
+	health map[string]*ServerHealth
+}
+
+// SetServers sets servers to pick from on GetChallenge
+func (p *Portal) SetServers(s *Servers) {
+	p.servers = s
+}
+
+// Restore last worked servers and health from st
+func (s *Servers) Restore(st ServersState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = st.Last
+	s.health = st.Health
+}
+
+// State returns a copy of last worked servers and health
+func (s *Servers) State() ServersState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := ServersState{
+		Last:   make(map[LoginType]string, len(s.last)),
+		Health: make(map[string]*ServerHealth, len(s.health)),
+	}
+	for k, v := range s.last {
+		st.Last[k] = v
+	}
+	for k, v := range s.health {
+		h := *v
+		st.Health[k] = &h
+	}
+	return st
+}
+
+// list returns servers of p in order to try: last worked one,
+// then the others by given order with failing ones moved to the end.
+// The configured server is always listed, even after failing over from it.
+func (s *Servers) list(p *Portal) []string {
+	var all []string
+	if p.autosip {
+		all = append(all, BuiltinServers[p.typ]...)
+	} else {
+		all = append(all, p.csip)
+	}
+	all = append(all, s.Extra[""]...)
+	all = append(all, s.Extra[p.typ]...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.last[p.typ]
+	seen := make(map[string]bool, len(all))
+	list := make([]string, 0, len(all))
+	for _, sip := range all {
+		if !seen[sip] {
+			seen[sip] = true
+			list = append(list, sip)
+		}
+	}
+	streak := func(sip string) int {
+		if h := s.health[sip]; h != nil {
+			return h.Streak
+		}
+		return 0
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if (list[i] == last) != (list[j] == last) {
+			return list[i] == last
+		}
+		return streak(list[i]) < streak(list[j])
+	})
+	return list
+}
+
+// report records the result of a request to sip at now
+func (s *Servers) report(lt LoginType, sip string, rtt time.Duration, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.health == nil {
+		s.health = make(map[string]*ServerHealth)
+	}
+	h := s.health[sip]
+	if h == nil {
+		h = &ServerHealth{}
+		s.health[sip] = h
+	}
+	if err != nil {
+		h.Fail++
+		h.Streak++
+		h.LastError = err.Error()
+		return
+	}
+	h.OK++
+	h.Streak = 0
+	h.RTT = rtt
+	h.LastOK = now
+	if s.last == nil {
+		s.last = make(map[LoginType]string)
+	}
+	s.last[lt] = sip
+}
+
+// serverResult of a challenge request
+type serverResult struct {
+	sip    string
+	r      *commonRsp
+	header http.Header
+	err    error
+}
+
+// try requests challenge from sip and reports its health.
+// A parsed response counts as healthy even if it is an error reply.
+func (s *Servers) try(p *Portal, sip string) serverResult {
+	start := time.Now()
+	r, header, err := p.challenge(sip)
+	s.report(p.typ, sip, time.Since(start), p.Now(), err)
+	if err != nil {
+		p.log().Warn("portal server failed", "server", sip, "err", err)
+	}
+	return serverResult{sip: sip, r: r, header: header, err: err}
+}
+
+// pickServer requests challenge by s.Mode and switches p to the server responded
+func (p *Portal) pickServer() (*commonRsp, http.Header, error) {
+	s := p.servers
+	list := s.list(p)
+	var res serverResult
+	if s.Mode == ServerModeRace && len(list) > 1 {
+		results := make(chan serverResult, len(list))
+		for _, sip := range list {
+			go func(sip string) {
+				results <- s.try(p, sip)
+			}(sip)
+		}
+		for range list {
+			res = <-results
+			if res.err == nil {
+				break
+			}
+		}
+	} else {
+		for _, sip := range list {
+			res = s.try(p, sip)
+			if res.err == nil {
+				break
+			}
+		}
+	}
+	if res.err == nil && p.sip != res.sip {
+		p.log().Info("use portal server", "server", res.sip)
+		p.sip = res.sip
+	}
+	return res.r, res.header, res.err
+}
@@ -0,0 +1,78 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newChallengeServer(delay time.Duration, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Query().Get("callback") + `({"error":"ok","challenge":"abc","client_ip":"1.2.3.4"})`))
+	}))
+}
+
+func TestServersFailover(t *testing.T) {
+	bad := newChallengeServer(0, http.StatusServiceUnavailable)
+	defer bad.Close()
+	good := newChallengeServer(0, http.StatusOK)
+	defer good.Close()
+	badip, goodip := strings.TrimPrefix(bad.URL, "http://"), strings.TrimPrefix(good.URL, "http://")
+
+	p, err := NewPortal("a", "1", badip, "1.2.3.4", LoginTypeShEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Servers{Extra: map[LoginType][]string{"": {goodip}}}
+	p.SetServers(s)
+	ch, err := p.GetChallenge()
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", ch)
+	assert.Equal(t, goodip, p.sip)
+
+	st := s.State()
+	assert.Equal(t, goodip, st.Last[LoginTypeShEdu])
+	assert.Equal(t, 1, st.Health[badip].Streak)
+	assert.Equal(t, 1, st.Health[goodip].OK)
+
+	// configured server is still listed after failing over from it
+	assert.Equal(t, []string{goodip, badip}, s.list(p))
+
+	// last worked server is tried first
+	p, _ = NewPortal("a", "1", badip, "1.2.3.4", LoginTypeShEdu)
+	assert.Equal(t, []string{goodip, badip}, s.list(p))
+}
+
+func TestServersRace(t *testing.T) {
+	slow := newChallengeServer(500*time.Millisecond, http.StatusOK)
+	defer slow.Close()
+	fast := newChallengeServer(0, http.StatusOK)
+	defer fast.Close()
+	slowip, fastip := strings.TrimPrefix(slow.URL, "http://"), strings.TrimPrefix(fast.URL, "http://")
+
+	p, err := NewPortal("a", "1", slowip, "1.2.3.4", LoginTypeShEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetServers(&Servers{Mode: ServerModeRace, Extra: map[LoginType][]string{LoginTypeShEdu: {fastip}}})
+	_, err = p.GetChallenge()
+	assert.NoError(t, err)
+	assert.Equal(t, fastip, p.sip)
+}
+
+func TestParseServerMode(t *testing.T) {
+	m, err := ParseServerMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, ServerModeFailover, m)
+	_, err = ParseServerMode("nope")
+	assert.Equal(t, ErrIllegalServerMode, err)
+}
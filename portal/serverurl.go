@@ -0,0 +1,99 @@
+package portal
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrIllegalServer is returned when a portal server is not a host, host:port or http(s) base URL
+var ErrIllegalServer = errors.New("illegal portal server")
+
+// ParseServer parses portal server s into its base URL. s can be
+// an IP, including a bare or bracketed IPv6 literal, a hostname, host:port,
+// or a full base URL with http or https scheme and an optional path prefix.
+func ParseServer(s string) (*url.URL, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.User != nil ||
+			u.RawQuery != "" || u.Fragment != "" || !validHost(u.Hostname()) || !validPort(u.Port()) {
+			return nil, ErrIllegalServer
+		}
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+		return u, nil
+	}
+	host, port := s, ""
+	if _, err := netip.ParseAddr(s); err != nil {
+		if h, p, err := net.SplitHostPort(s); err == nil {
+			host, port = h, p
+		} else if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+			host = s[1 : len(s)-1]
+		}
+	}
+	if !validHost(host) || !validPort(port) {
+		return nil, ErrIllegalServer
+	}
+	u := &url.URL{Scheme: "http", Host: host}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	}
+	return u, nil
+}
+
+// ServerBaseURL returns the base URL of portal server s without trailing slash
+func ServerBaseURL(s string) (string, error) {
+	u, err := ParseServer(s)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// serverHost returns the host of portal server s, s itself if illegal
+func serverHost(s string) string {
+	u, err := ParseServer(s)
+	if err != nil {
+		return s
+	}
+	return u.Hostname()
+}
+
+// validHost reports whether h is an IP without zone or a hostname
+func validHost(h string) bool {
+	if a, err := netip.ParseAddr(h); err == nil {
+		return a.Zone() == ""
+	}
+	if h == "" || len(h) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(h, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validPort reports whether p is empty or in [1, 65535]
+func validPort(p string) bool {
+	if p == "" {
+		return true
+	}
+	n, err := strconv.Atoi(p)
+	return err == nil && n > 0 && n <= 65535
+}
@@ -0,0 +1,61 @@
+package portal
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerBaseURL(t *testing.T) {
+	for s, expected := range map[string]string{
+		"10.253.0.237":                      "http://10.253.0.237",
+		"10.253.0.237:8080":                 "http://10.253.0.237:8080",
+		"portal.example.edu":                "http://portal.example.edu",
+		"portal.example.edu:8080":           "http://portal.example.edu:8080",
+		"2001:db8::1":                       "http://[2001:db8::1]",
+		"[2001:db8::1]":                     "http://[2001:db8::1]",
+		"[2001:db8::1]:8080":                "http://[2001:db8::1]:8080",
+		"https://portal.example.edu/srun/":  "https://portal.example.edu/srun",
+		"http://[2001:db8::1]:8080/a/b":     "http://[2001:db8::1]:8080/a/b",
+		" https://portal.example.edu:8443 ": "https://portal.example.edu:8443",
+	} {
+		u, err := ServerBaseURL(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, u, s)
+	}
+	for _, s := range []string{"", "ftp://a", "http://", "a b", "a:0", "a:x", "https://a/?q=1", "-a.edu", "fe80::1%eth0", "http://u:p@a"} {
+		_, err := ServerBaseURL(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestGetChallengeURLBase(t *testing.T) {
+	u, err := GetChallengeURL("https://portal.example.edu/srun", "cb", "a", "@dx", "1.2.3.4", 1)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, "https://portal.example.edu/srun/cgi-bin/get_challenge?"), u)
+	u, err = GetUserStatusURL("2001:db8::1", "cb", "", 1)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, "http://[2001:db8::1]/cgi-bin/rad_user_info?"), u)
+}
+
+func TestDNSServer(t *testing.T) {
+	var asked bool
+	dialer.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			asked = true
+			return nil, &net.DNSError{Err: "refused", IsNotFound: true}
+		},
+	}
+	defer SetDNSServer("")
+	p, err := NewPortal("a", "1", "portal.example.edu:8080", "1.2.3.4", LoginTypeShEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.GetChallenge()
+	assert.Error(t, err)
+	assert.True(t, asked)
+}
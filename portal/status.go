@@ -0,0 +1,150 @@
+package portal
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/fumiama/go-nd-portal/helper"
+)
+
+var (
+	// ErrUnexpectedStatusResponse is returned when status resp is shorter than expected
+	ErrUnexpectedStatusResponse = errors.New("unexpected status response")
+	// ErrUnexpectedLogoutResponse is returned when logout resp is shorter than expected
+	ErrUnexpectedLogoutResponse = errors.New("unexpected logout response")
+)
+
+// OccupiedError is returned when the client IP is online with another account
+type OccupiedError struct {
+	IP       string
+	UserName string
+}
+
+// Error implements the error interface for OccupiedError
+func (e *OccupiedError) Error() string {
+	return "ip " + e.IP + " is already online with another account: " + e.UserName
+}
+
+// UserStatus struct for rad_user_info response
+type UserStatus struct {
+	Status   string `json:"error"`
+	ErrorMsg string `json:"error_msg"`
+
+	UserName    string  `json:"user_name"`
+	ClientIP    string  `json:"client_ip"`
+	OnlineIP    string  `json:"online_ip"`
+	AddTime     int64   `json:"add_time"`
+	SumBytes    int64   `json:"sum_bytes"`
+	SumSeconds  int64   `json:"sum_seconds"`
+	UserBalance float64 `json:"user_balance"`
+	ServerTime  int64   `json:"st"`
+}
+
+// Online reports whether any account is online on the queried IP
+func (s *UserStatus) Online() bool {
+	return s.Status == "ok" && s.UserName != ""
+}
+
+// Status queries online status of client IP, the IP seen by server is used if cip is empty
+func (p *Portal) Status() (*UserStatus, error) {
+	return p.statusOf(p.cip)
+}
+
+// statusOf queries online status of ip
+func (p *Portal) statusOf(ip string) (*UserStatus, error) {
+	u, err := GetUserStatusURL(
+		p.sip,
+		"gondportal",
+		ip,
+		p.Now().UnixMilli(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	data, err := p.get(u)
+	if err != nil {
+		return nil, err
+	}
+	p.log().Debug("get status resp", "data", helper.BytesToString(data))
+	if len(data) < 12 {
+		return nil, ErrUnexpectedStatusResponse
+	}
+
+	var s UserStatus
+	err = json.Unmarshal(data[11:len(data)-1], &s)
+	if err != nil {
+		return nil, err
+	}
+	if s.ServerTime > 0 {
+		p.clock.update(time.Unix(s.ServerTime, 0), time.Second, p.log())
+	}
+	if s.Status != "ok" && s.Status != "not_online_error" {
+		if s.ErrorMsg != "" {
+			return nil, errors.New(s.ErrorMsg)
+		}
+		return nil, errors.New(s.Status)
+	}
+	return &s, nil
+}
+
+// IsOnline reports whether p is already online on its client IP.
+// An *OccupiedError is returned if another account holds the IP.
+func (p *Portal) IsOnline() (bool, error) {
+	s, err := p.Status()
+	if err != nil {
+		return false, err
+	}
+	if !s.Online() {
+		return false, nil
+	}
+	if !p.SameUser(s.UserName) {
+		ip := s.OnlineIP
+		if ip == "" {
+			ip = p.cip
+		}
+		return false, &OccupiedError{IP: ip, UserName: s.UserName}
+	}
+	p.oip = s.OnlineIP
+	return true, nil
+}
+
+// SameUser compares name in status resp, which may or may not carry domain
+func (p *Portal) SameUser(name string) bool {
+	if i := strings.IndexByte(name, '@'); i >= 0 {
+		return name == p.name+p.domain
+	}
+	return name == p.name
+}
+
+// Logout sends logout request to server
+func (p *Portal) Logout() error {
+	u, err := GetLogoutURL(
+		p.sip,
+		"gondportal",
+		p.name,
+		p.domain,
+		p.acid,
+		p.cip,
+		p.Now().UnixMilli(),
+	)
+	if err != nil {
+		return err
+	}
+	data, err := p.get(u)
+	if err != nil {
+		return err
+	}
+	p.log().Debug("get logout resp", "data", helper.BytesToString(data))
+	if len(data) < 12 {
+		return ErrUnexpectedLogoutResponse
+	}
+
+	var r commonRsp
+	err = json.Unmarshal(data[11:len(data)-1], &r)
+	if err != nil {
+		return err
+	}
+	return r.err(p.log())
+}
@@ -0,0 +1,71 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serves jsonp wrapped resp for each cgi path
+func newTestServer(t *testing.T, resps map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := resps[r.URL.Path]
+		if !ok {
+			t.Error("unexpected path:", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Query().Get("callback") + "(" + resp + ")"))
+	}))
+}
+
+func TestIsOnline(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/cgi-bin/rad_user_info": `{"error":"ok","user_name":"2000010101001","online_ip":"1.2.3.4","sum_bytes":1024}`,
+	})
+	defer srv.Close()
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online, err := u.IsOnline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, online)
+
+	u.name = "2000010101002"
+	_, err = u.IsOnline()
+	assert.Equal(t, &OccupiedError{IP: "1.2.3.4", UserName: "2000010101001"}, err)
+}
+
+func TestIsOffline(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/cgi-bin/rad_user_info": `{"error":"not_online_error","client_ip":"1.2.3.4","online_ip":"1.2.3.4"}`,
+	})
+	defer srv.Close()
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online, err := u.IsOnline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, online)
+}
+
+func TestLogout(t *testing.T) {
+	srv := newTestServer(t, map[string]string{
+		"/cgi-bin/srun_portal": `{"error":"ok","suc_msg":"logout_ok"}`,
+	})
+	defer srv.Close()
+	u, err := NewPortal("2000010101001", "12345678", strings.TrimPrefix(srv.URL, "http://"), "1.2.3.4", LoginTypeQshEdu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, u.Logout())
+}
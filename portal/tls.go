@@ -0,0 +1,205 @@
+package portal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrNoCertificate is returned when CA file contains no PEM certificate
+	ErrNoCertificate = errors.New("no certificate in CA file")
+	// ErrIllegalPin is returned when a pin is not a hex SHA-256 fingerprint
+	ErrIllegalPin = errors.New("illegal certificate pin")
+	// ErrPinMismatch is returned when no certificate of server matches pins
+	ErrPinMismatch = errors.New("server certificate does not match any pin")
+)
+
+// PinMismatchError is ErrPinMismatch with the error of verifying the chain to a pinned root
+type PinMismatchError struct {
+	Err error
+}
+
+// Error implements the error interface for PinMismatchError
+func (e *PinMismatchError) Error() string {
+	return ErrPinMismatch.Error() + ": " + e.Err.Error()
+}
+
+// Is reports whether target is ErrPinMismatch
+func (e *PinMismatchError) Is(target error) bool {
+	return target == ErrPinMismatch
+}
+
+// Unwrap returns the error of verifying
+func (e *PinMismatchError) Unwrap() error {
+	return e.Err
+}
+
+// TLSOptions for HTTPS portal servers
+type TLSOptions struct {
+	// CAFile of PEM certificates trusted besides system roots
+	CAFile string
+	// Pins are SHA-256 fingerprints of certificates in hex, colons allowed.
+	// With CAFile, one of the certificates in the verified chain must match.
+	// Without it, either the leaf must match, or the chain must verify
+	// against a pinned certificate as root, with server name checked.
+	Pins []string
+	// Insecure skips all verification
+	Insecure bool
+	// Log receives the warning of Insecure, discarded if nil
+	Log Logger
+}
+
+// ParsePin parses hex SHA-256 fingerprint like "AB:CD:..." or "abcd..."
+func ParsePin(s string) ([]byte, error) {
+	pin, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+	if err != nil || len(pin) != sha256.Size {
+		return nil, ErrIllegalPin
+	}
+	return pin, nil
+}
+
+// SetTLS applies o to HTTPS requests to portal servers, default verification if o is nil
+func SetTLS(o *TLSOptions) error {
+	// connections verified by old config must not be reused
+	defer transport.CloseIdleConnections()
+	transport.DialTLSContext = nil
+	if o == nil {
+		transport.TLSClientConfig = nil
+		return nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return ErrNoCertificate
+		}
+		cfg.RootCAs = pool
+	}
+	if len(o.Pins) > 0 {
+		pins := make([][]byte, 0, len(o.Pins))
+		for _, s := range o.Pins {
+			pin, err := ParsePin(s)
+			if err != nil {
+				return err
+			}
+			pins = append(pins, pin)
+		}
+		if o.CAFile == "" {
+			// tls does not verify the chain, which is done with host name by verifyPins
+			cfg.InsecureSkipVerify = true
+			transport.DialTLSContext = dialPinnedTLS(cfg, pins)
+		} else {
+			cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+				return verifyPins(cs, "", pins)
+			}
+		}
+	}
+	if o.Insecure {
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = nil
+		transport.DialTLSContext = nil
+		log := redactLogger(o.Log)
+		log.Warn("!!! INSECURE: TLS certificate of portal server is NOT verified,")
+		log.Warn("!!! anyone on the path can read your password hash and info.")
+	}
+	transport.TLSClientConfig = cfg
+	return nil
+}
+
+// pinned reports whether cert matches one of pins
+func pinned(cert *x509.Certificate, pins [][]byte) bool {
+	sum := sha256.Sum256(cert.Raw)
+	for _, pin := range pins {
+		if bytes.Equal(sum[:], pin) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialPinnedTLS dials by dialer and handshakes by cfg, verifying server of host by pins
+func dialPinnedTLS(cfg *tls.Config, pins [][]byte) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c := cfg.Clone()
+		c.ServerName = host
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, host, pins)
+		}
+		if d := transport.TLSHandshakeTimeout; d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, d)
+			defer cancel()
+		}
+		tc := tls.Client(conn, c)
+		err = tc.HandshakeContext(ctx)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+}
+
+// verifyPins checks cs against pins. If tls did not verify the chain,
+// the leaf must be pinned, or the chain must verify against a pinned
+// certificate as root with host name checked.
+func verifyPins(cs tls.ConnectionState, host string, pins [][]byte) error {
+	if len(cs.VerifiedChains) > 0 {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if pinned(cert, pins) {
+					return nil
+				}
+			}
+		}
+		return ErrPinMismatch
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return ErrPinMismatch
+	}
+	leaf := cs.PeerCertificates[0]
+	if pinned(leaf, pins) {
+		return nil
+	}
+	roots, inters := x509.NewCertPool(), x509.NewCertPool()
+	hasRoot := false
+	for _, cert := range cs.PeerCertificates[1:] {
+		if pinned(cert, pins) {
+			roots.AddCert(cert)
+			hasRoot = true
+		} else {
+			inters.AddCert(cert)
+		}
+	}
+	if !hasRoot {
+		return ErrPinMismatch
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots, Intermediates: inters})
+	if err != nil {
+		return &PinMismatchError{Err: err}
+	}
+	return nil
+}
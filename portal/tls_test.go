@@ -0,0 +1,118 @@
+package portal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Query().Get("callback") + `({"error":"ok","challenge":"abc","client_ip":"1.2.3.4"})`))
+	}))
+	defer srv.Close()
+	defer SetTLS(nil)
+
+	challenge := func() error {
+		p, err := NewPortal("a", "1", srv.URL, "1.2.3.4", LoginTypeShEdu)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.GetChallenge()
+		return err
+	}
+	// self-signed is refused by default
+	assert.Error(t, challenge())
+
+	sum := sha256.Sum256(srv.Certificate().Raw)
+	assert.NoError(t, SetTLS(&TLSOptions{Pins: []string{hex.EncodeToString(sum[:])}}))
+	assert.NoError(t, challenge())
+
+	sum[0]++
+	assert.NoError(t, SetTLS(&TLSOptions{Pins: []string{hex.EncodeToString(sum[:])}}))
+	assert.ErrorIs(t, challenge(), ErrPinMismatch)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, SetTLS(&TLSOptions{CAFile: ca}))
+	assert.NoError(t, challenge())
+
+	assert.NoError(t, SetTLS(&TLSOptions{Insecure: true}))
+	assert.NoError(t, challenge())
+
+	_, err = ParsePin("ab:cd")
+	assert.Equal(t, ErrIllegalPin, err)
+}
+
+// newCert makes a certificate of name signed by parent, self-signed if parent is nil
+func newCert(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if !ca {
+		tmpl.DNSNames = []string{name}
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestVerifyPins(t *testing.T) {
+	ca, caKey := newCert(t, "ca", true, nil, nil)
+	leaf, _ := newCert(t, "portal.test", false, ca, caKey)
+	mitm, _ := newCert(t, "portal.test", false, nil, nil)
+	pin := func(c *x509.Certificate) [][]byte {
+		sum := sha256.Sum256(c.Raw)
+		return [][]byte{sum[:]}
+	}
+	state := func(certs ...*x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{PeerCertificates: certs}
+	}
+
+	assert.NoError(t, verifyPins(state(leaf, ca), "portal.test", pin(ca)))
+	assert.NoError(t, verifyPins(state(leaf, ca), "other.test", pin(leaf)))
+	// pinned ca appended to a leaf it did not sign
+	assert.ErrorIs(t, verifyPins(state(mitm, ca), "portal.test", pin(ca)), ErrPinMismatch)
+	// leaf of pinned ca for another host
+	assert.ErrorIs(t, verifyPins(state(leaf, ca), "other.test", pin(ca)), ErrPinMismatch)
+	assert.ErrorIs(t, verifyPins(state(leaf, ca), "portal.test", pin(mitm)), ErrPinMismatch)
+	assert.ErrorIs(t, verifyPins(state(), "portal.test", pin(ca)), ErrPinMismatch)
+}
@@ -1,35 +1,179 @@
 package portal
 
 import (
-	"errors"
-	"fmt"
+	"context"
 	"io"
+	"net"
 	"net/http"
+	"time"
 )
 
-var client = &http.Client{}
+// HTTPOptions limits requests to portal servers
+type HTTPOptions struct {
+	// DialTimeout of TCP connect
+	DialTimeout time.Duration
+	// TLSTimeout of TLS handshake
+	TLSTimeout time.Duration
+	// ResponseTimeout waiting for response headers after request is sent
+	ResponseTimeout time.Duration
+	// Timeout of the whole request including reading body and redirects
+	Timeout time.Duration
+	// MaxBodySize in bytes, larger bodies fail with ErrBodyTooLarge
+	MaxBodySize int64
+	// MaxRedirects to follow within the same host, never downgrading https,
+	// negative to follow none
+	MaxRedirects int
+}
+
+// DefaultHTTPOptions are applied until SetHTTPOptions is called
+var DefaultHTTPOptions = HTTPOptions{
+	DialTimeout:     5 * time.Second,
+	TLSTimeout:      5 * time.Second,
+	ResponseTimeout: 10 * time.Second,
+	Timeout:         30 * time.Second,
+	MaxBodySize:     1 << 20,
+	MaxRedirects:    3,
+}
+
+var (
+	httpOptions = DefaultHTTPOptions
+	dialer      = &net.Dialer{Timeout: httpOptions.DialTimeout}
+	transport   = newTransport()
+	client      = &http.Client{
+		Transport:     transport,
+		Timeout:       httpOptions.Timeout,
+		CheckRedirect: checkRedirect,
+	}
+)
+
+// newTransport clones default transport to dial by dialer
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = httpOptions.TLSTimeout
+	t.ResponseHeaderTimeout = httpOptions.ResponseTimeout
+	return t
+}
+
+// SetHTTPOptions applies o to requests to portal servers, zero fields are taken from DefaultHTTPOptions
+func SetHTTPOptions(o HTTPOptions) {
+	d := DefaultHTTPOptions
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = d.DialTimeout
+	}
+	if o.TLSTimeout <= 0 {
+		o.TLSTimeout = d.TLSTimeout
+	}
+	if o.ResponseTimeout <= 0 {
+		o.ResponseTimeout = d.ResponseTimeout
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = d.Timeout
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = d.MaxBodySize
+	}
+	if o.MaxRedirects == 0 {
+		o.MaxRedirects = d.MaxRedirects
+	}
+	httpOptions = o
+	dialer.Timeout = o.DialTimeout
+	transport.TLSHandshakeTimeout = o.TLSTimeout
+	transport.ResponseHeaderTimeout = o.ResponseTimeout
+	client.Timeout = o.Timeout
+}
 
-// requestDataWith 使用自定义请求头获取数据
-func requestDataWith(url, method, ua string) (data []byte, err error) {
+// checkRedirect follows redirects within the same host only,
+// others like those to a captive page are returned as RedirectError
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	first := via[0].URL
+	if len(via) > httpOptions.MaxRedirects || req.URL.Hostname() != first.Hostname() ||
+		(first.Scheme == "https" && req.URL.Scheme != "https") {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// SetDNSServer resolves portal server hostnames by DNS server addr (host:port)
+// instead of system resolver, system resolver if addr is empty
+func SetDNSServer(addr string) {
+	if addr == "" {
+		dialer.Resolver = nil
+		return
+	}
+	dialer.Resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+// requestDataWith 使用自定义请求头获取数据, 并返回响应头
+func requestDataWith(url, method, ua string) (data []byte, header http.Header, err error) {
 	// 提交请求
 	var request *http.Request
 	request, err = http.NewRequest(method, url, nil)
-	if err == nil {
-		// 增加header选项
-		if ua != "" {
-			request.Header.Add("User-Agent", ua)
+	if err != nil {
+		return
+	}
+	// 增加header选项
+	if ua != "" {
+		request.Header.Add("User-Agent", ua)
+	}
+	var response *http.Response
+	response, err = client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	header = response.Header
+	// 多读一字节以判断是否超限
+	data, err = io.ReadAll(io.LimitReader(response.Body, httpOptions.MaxBodySize+1))
+	if err != nil {
+		return
+	}
+	if int64(len(data)) > httpOptions.MaxBodySize {
+		return nil, header, ErrBodyTooLarge
+	}
+	switch {
+	case response.StatusCode >= 300 && response.StatusCode < 400:
+		return nil, header, &RedirectError{
+			StatusCode: response.StatusCode,
+			Location:   response.Header.Get("Location"),
 		}
-		var response *http.Response
-		response, err = client.Do(request)
-		if err == nil {
-			if response.StatusCode != http.StatusOK {
-				s := fmt.Sprintf("status code: %d", response.StatusCode)
-				err = errors.New(s)
-				return
-			}
-			data, err = io.ReadAll(response.Body)
-			response.Body.Close()
+	case response.StatusCode != http.StatusOK:
+		return nil, header, &StatusError{
+			StatusCode: response.StatusCode,
+			Body:       snippet(data),
 		}
 	}
 	return
 }
+
+// get 按限速获取数据并根据响应头的 Date 同步服务器时钟
+func (p *Portal) get(u string) ([]byte, error) {
+	data, header, err := p.fetch(u)
+	p.syncClock(header)
+	return data, err
+}
+
+// fetch 按限速获取数据, 不修改 p 因而可以并发调用
+func (p *Portal) fetch(u string) ([]byte, http.Header, error) {
+	if p.limiter != nil {
+		p.limiter.Wait()
+	}
+	p.log().Debug("GET", "url", u)
+	return requestDataWith(u, "GET", PortalHeaderUA)
+}
+
+// syncClock 根据响应头的 Date 同步服务器时钟
+func (p *Portal) syncClock(header http.Header) {
+	if d := header.Get("Date"); d != "" {
+		t, err := http.ParseTime(d)
+		if err == nil {
+			p.clock.update(t, time.Second, p.log())
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package portal
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestDataWith(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/captive":
+			http.Redirect(w, r, "http://login.example.edu/?from=portal", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/ok":
+			_, _ = w.Write([]byte("ok"))
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("a", 2048)))
+		case "/slow":
+			time.Sleep(time.Second)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(`{"error":"bad","password":"secret"}`))
+		}
+	}))
+	defer srv.Close()
+	defer SetHTTPOptions(DefaultHTTPOptions)
+	SetHTTPOptions(HTTPOptions{MaxBodySize: 1024, ResponseTimeout: 200 * time.Millisecond})
+
+	data, _, err := requestDataWith(srv.URL+"/moved", "GET", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+
+	_, _, err = requestDataWith(srv.URL+"/captive", "GET", "")
+	assert.Equal(t, &RedirectError{StatusCode: http.StatusFound, Location: "http://login.example.edu/?from=portal"}, err)
+
+	_, _, err = requestDataWith(srv.URL+"/large", "GET", "")
+	assert.Equal(t, ErrBodyTooLarge, err)
+
+	_, _, err = requestDataWith(srv.URL+"/bad", "GET", "")
+	var se *StatusError
+	assert.True(t, errors.As(err, &se))
+	assert.Equal(t, http.StatusBadGateway, se.StatusCode)
+	assert.Equal(t, `{"error":"bad","password":"***"}`, se.Body)
+
+	_, _, err = requestDataWith(srv.URL+"/slow", "GET", "")
+	assert.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "a=1&password=***&info=***&n=200", Redact("a=1&password={MD5}abc&info={SRBX1}xyz&n=200"))
+	assert.Equal(t, `{"challenge":"***","ok":1}`, Redact(`{"challenge":"abc","ok":1}`))
+	assert.Len(t, snippet([]byte(strings.Repeat("字", 200))), 255)
+}
@@ -0,0 +1,188 @@
+// Package quota guards traffic usage against monthly package limits
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrIllegalAction is returned when an unknown action is provided
+	ErrIllegalAction = errors.New("illegal quota action")
+	// ErrIllegalThreshold is returned when a threshold is not in (0, 100]
+	ErrIllegalThreshold = errors.New("illegal quota threshold")
+	// ErrIllegalCycleDay is returned when cycle day is not in [1, 28]
+	ErrIllegalCycleDay = errors.New("illegal billing cycle day")
+)
+
+// GiB in bytes
+const GiB = 1 << 30
+
+// Action to take past the hard cap
+type Action string
+
+const (
+	// ActionAlert only fires alerts
+	ActionAlert Action = "alert"
+	// ActionLogout logs out and refuses to log in until next cycle
+	ActionLogout Action = "logout"
+	// ActionRefuse keeps current session but refuses to log in until next cycle
+	ActionRefuse Action = "refuse"
+)
+
+// ParseAction checks s and converts it to Action, empty for alert
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case "":
+		return ActionAlert, nil
+	case ActionAlert, ActionLogout, ActionRefuse:
+		return a, nil
+	default:
+		return "", ErrIllegalAction
+	}
+}
+
+// ParseThresholds parses comma separated percents like "80,95"
+func ParseThresholds(s string) ([]float64, error) {
+	var ths []float64
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(item), "%"))
+		if item == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(item, 64)
+		if err != nil || v <= 0 || v > 100 {
+			return nil, ErrIllegalThreshold
+		}
+		ths = append(ths, v)
+	}
+	sort.Float64s(ths)
+	return ths, nil
+}
+
+// Alert is fired once per cycle when usage crosses a threshold
+type Alert struct {
+	// Percent of the threshold crossed
+	Percent float64
+	Used    int64
+	Limit   int64
+}
+
+// String formats alert for logs
+func (a Alert) String() string {
+	return fmt.Sprintf("traffic usage %.2f GiB crossed %g%% of %.2f GiB",
+		float64(a.Used)/GiB, a.Percent, float64(a.Limit)/GiB)
+}
+
+// Guard checks usage samples against limit
+type Guard struct {
+	// Limit of the package in bytes
+	Limit int64
+	// Thresholds in percent of Limit to alert, ascending
+	Thresholds []float64
+	// Cap in percent of Limit to take Action, 0 to disable
+	Cap float64
+	// Action past Cap
+	Action Action
+	// CycleDay is the day of month the billing cycle starts on, 1 if 0
+	CycleDay int
+	// Location of cycle boundaries, local if nil
+	Location *time.Location
+
+	cycle  time.Time
+	fired  int
+	capped bool
+}
+
+// State is the persistable part of Guard in a cycle
+type State struct {
+	Cycle  time.Time `json:"cycle"`
+	Fired  int       `json:"fired"`
+	Capped bool      `json:"capped"`
+}
+
+// Equal reports whether st and o are the same
+func (st State) Equal(o State) bool {
+	return st.Cycle.Equal(o.Cycle) && st.Fired == o.Fired && st.Capped == o.Capped
+}
+
+// State returns alerts fired and cap of current cycle
+func (g *Guard) State() State {
+	return State{Cycle: g.cycle, Fired: g.fired, Capped: g.capped}
+}
+
+// Restore alerts fired and cap from st, which Roll lifts in a new cycle
+func (g *Guard) Restore(st State) {
+	g.cycle, g.fired, g.capped = st.Cycle, st.Fired, st.Capped
+	if g.fired > len(g.Thresholds) {
+		g.fired = len(g.Thresholds)
+	}
+}
+
+// CycleStart returns the start of the billing cycle containing t
+func (g *Guard) CycleStart(t time.Time) time.Time {
+	if g.Location != nil {
+		t = t.In(g.Location)
+	}
+	day := g.CycleDay
+	if day <= 0 {
+		day = 1
+	}
+	start := time.Date(t.Year(), t.Month(), day, 0, 0, 0, 0, t.Location())
+	if start.After(t) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// CycleEnd returns the start of the next billing cycle after t
+func (g *Guard) CycleEnd(t time.Time) time.Time {
+	return g.CycleStart(t).AddDate(0, 1, 0)
+}
+
+// Check evaluates usage at now, returning newly crossed alerts.
+// A new cycle re-arms alerts and lifts the cap.
+func (g *Guard) Check(now time.Time, used int64) []Alert {
+	g.Roll(now)
+	if g.Limit <= 0 {
+		return nil
+	}
+	percent := float64(used) * 100 / float64(g.Limit)
+	var alerts []Alert
+	for g.fired < len(g.Thresholds) && percent >= g.Thresholds[g.fired] {
+		alerts = append(alerts, Alert{Percent: g.Thresholds[g.fired], Used: used, Limit: g.Limit})
+		g.fired++
+	}
+	if g.Cap > 0 && percent >= g.Cap {
+		g.capped = true
+	}
+	return alerts
+}
+
+// Roll re-arms alerts and lifts the cap if now is in a new cycle
+func (g *Guard) Roll(now time.Time) {
+	if c := g.CycleStart(now); !c.Equal(g.cycle) {
+		g.cycle = c
+		g.fired = 0
+		g.capped = false
+	}
+}
+
+// Capped reports whether usage crossed Cap in current cycle
+func (g *Guard) Capped() bool {
+	return g.capped
+}
+
+// ShouldLogout reports whether current session should be logged out
+func (g *Guard) ShouldLogout() bool {
+	return g.capped && g.Action == ActionLogout
+}
+
+// RefuseLogin reports whether new logins should be refused
+func (g *Guard) RefuseLogin() bool {
+	return g.capped && (g.Action == ActionLogout || g.Action == ActionRefuse)
+}
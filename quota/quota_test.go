@@ -0,0 +1,66 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThresholds(t *testing.T) {
+	ths, err := ParseThresholds("95, 80%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []float64{80, 95}, ths)
+	_, err = ParseThresholds("120")
+	assert.Equal(t, ErrIllegalThreshold, err)
+}
+
+func TestCycle(t *testing.T) {
+	g := Guard{CycleDay: 15, Location: time.UTC}
+	assert.Equal(t, time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC), g.CycleStart(time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), g.CycleStart(time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 11, 15, 0, 0, 0, 0, time.UTC), g.CycleEnd(time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestGuardCheck(t *testing.T) {
+	g := Guard{
+		Limit:      100 * GiB,
+		Thresholds: []float64{80, 95},
+		Cap:        100,
+		Action:     ActionLogout,
+		Location:   time.UTC,
+	}
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	assert.Empty(t, g.Check(now, 50*GiB))
+	assert.Equal(t, []Alert{{Percent: 80, Used: 81 * GiB, Limit: 100 * GiB}}, g.Check(now, 81*GiB))
+	assert.Empty(t, g.Check(now, 82*GiB))
+	assert.False(t, g.RefuseLogin())
+	assert.Equal(t, []Alert{{Percent: 95, Used: 100 * GiB, Limit: 100 * GiB}}, g.Check(now, 100*GiB))
+	assert.True(t, g.ShouldLogout())
+	assert.True(t, g.RefuseLogin())
+
+	// next cycle re-arms
+	assert.Empty(t, g.Check(now.AddDate(0, 1, 0), 1*GiB))
+	assert.False(t, g.Capped())
+	assert.Equal(t, "traffic usage 81.00 GiB crossed 80% of 100.00 GiB", Alert{Percent: 80, Used: 81 * GiB, Limit: 100 * GiB}.String())
+}
+
+func TestGuardRestore(t *testing.T) {
+	g := Guard{Limit: 100 * GiB, Thresholds: []float64{80}, Cap: 100, Action: ActionLogout, Location: time.UTC}
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	g.Check(now, 101*GiB)
+	st := g.State()
+
+	// restarted guard refuses login in the same cycle
+	r := Guard{Limit: 100 * GiB, Thresholds: []float64{80}, Cap: 100, Action: ActionLogout, Location: time.UTC}
+	r.Restore(st)
+	r.Roll(now.Add(time.Hour))
+	assert.True(t, r.RefuseLogin())
+	assert.Empty(t, r.Check(now.Add(time.Hour), 101*GiB))
+
+	// and lifts the cap in a new cycle
+	r.Roll(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC))
+	assert.False(t, r.RefuseLogin())
+}
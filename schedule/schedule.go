@@ -0,0 +1,326 @@
+// Package schedule parses cron-like login and logout rules
+package schedule
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrIllegalAction is returned when an unknown action is provided
+	ErrIllegalAction = errors.New("illegal schedule action")
+	// ErrIllegalSpec is returned when a cron spec can not be parsed
+	ErrIllegalSpec = errors.New("illegal cron spec")
+	// ErrIllegalWindow is returned when a quiet window can not be parsed
+	ErrIllegalWindow = errors.New("illegal quiet window")
+)
+
+// Action to take at scheduled time
+type Action string
+
+const (
+	// ActionLogin logs in if not online
+	ActionLogin Action = "login"
+	// ActionLogout logs out and stops keepalive until next login
+	ActionLogout Action = "logout"
+	// ActionRelogin logs out and logs in again, e.g. to reset session limits
+	ActionRelogin Action = "relogin"
+	// actionQuiet is the keyword of quiet windows
+	actionQuiet = "quiet"
+)
+
+// Spec is a standard 5-field cron spec: minute hour day-of-month month day-of-week
+type Spec struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar records "*" for the or-rule of dom and dow
+	domStar, dowStar bool
+}
+
+// fieldRanges of the 5 fields
+var fieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// ParseSpec parses spec like "30 23 * * 1-5", supporting *, lists, ranges and steps
+func ParseSpec(s string) (*Spec, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, ErrIllegalSpec
+	}
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseField(f, fieldRanges[i][0], fieldRanges[i][1])
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+	// 7 is also sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Spec{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domStar: fields[2] == "*", dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseField parses one comma separated cron field into a bitset
+func parseField(f string, lo, hi int) (uint64, error) {
+	if lo == 0 && hi == 6 {
+		// allow 7 as sunday
+		hi = 7
+	}
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, ErrIllegalSpec
+			}
+			part = part[:i]
+		}
+		from, to := lo, hi
+		switch {
+		case part == "*":
+		case strings.IndexByte(part, '-') >= 0:
+			i := strings.IndexByte(part, '-')
+			var err1, err2 error
+			from, err1 = strconv.Atoi(part[:i])
+			to, err2 = strconv.Atoi(part[i+1:])
+			if err1 != nil || err2 != nil {
+				return 0, ErrIllegalSpec
+			}
+		default:
+			var err error
+			from, err = strconv.Atoi(part)
+			if err != nil {
+				return 0, ErrIllegalSpec
+			}
+			to = from
+			if step > 1 {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, ErrIllegalSpec
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// has reports whether bit v is set in bits
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// dayMatches applies the cron or-rule when both dom and dow are restricted
+func (s *Spec) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first matching minute strictly after t in t's location,
+// or zero time if none within 5 years
+func (s *Spec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// Window is a daily quiet window in minutes of day, it may cross midnight
+type Window struct {
+	From, To int
+}
+
+// ParseWindow parses window like "00:00-06:00"
+func ParseWindow(s string) (Window, error) {
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		return Window{}, ErrIllegalWindow
+	}
+	from, err := parseClock(s[:i])
+	if err != nil {
+		return Window{}, err
+	}
+	to, err := parseClock(s[i+1:])
+	if err != nil {
+		return Window{}, err
+	}
+	return Window{From: from, To: to}, nil
+}
+
+// parseClock parses HH:MM into minutes of day
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, ErrIllegalWindow
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t is in the window
+func (w Window) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.From <= w.To {
+		return m >= w.From && m < w.To
+	}
+	return m >= w.From || m < w.To
+}
+
+// Rule is one scheduled action
+type Rule struct {
+	Action Action
+	Spec   *Spec
+}
+
+// Event is an action at a time
+type Event struct {
+	At     time.Time
+	Action Action
+}
+
+// Schedule of login and logout actions
+type Schedule struct {
+	Rules []Rule
+	// Quiet windows suppress keepalive retries
+	Quiet []Window
+	// Location of rules and windows, local if nil
+	Location *time.Location
+	// Jitter is the max random delay added when running actions
+	Jitter time.Duration
+}
+
+// Parse parses rules separated by ";" or newlines, e.g.
+//
+//	login 0 7 * * *; logout 30 23 * * *; quiet 00:00-06:00; relogin 0 5 * * *
+func Parse(s string) (*Schedule, error) {
+	var sch Schedule
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		action, arg, _ := strings.Cut(line, " ")
+		switch Action(action) {
+		case actionQuiet:
+			w, err := ParseWindow(arg)
+			if err != nil {
+				return nil, err
+			}
+			sch.Quiet = append(sch.Quiet, w)
+		case ActionLogin, ActionLogout, ActionRelogin:
+			spec, err := ParseSpec(arg)
+			if err != nil {
+				return nil, err
+			}
+			sch.Rules = append(sch.Rules, Rule{Action: Action(action), Spec: spec})
+		default:
+			return nil, ErrIllegalAction
+		}
+	}
+	return &sch, nil
+}
+
+// in converts t to the location of s
+func (s *Schedule) in(t time.Time) time.Time {
+	if s.Location != nil {
+		return t.In(s.Location)
+	}
+	return t.Local()
+}
+
+// IsQuiet reports whether t is in any quiet window
+func (s *Schedule) IsQuiet(t time.Time) bool {
+	if s == nil {
+		return false
+	}
+	t = s.in(t)
+	for _, w := range s.Quiet {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first event strictly after t
+func (s *Schedule) Next(t time.Time) (Event, bool) {
+	if s == nil {
+		return Event{}, false
+	}
+	t = s.in(t)
+	var ev Event
+	for _, r := range s.Rules {
+		at := r.Spec.Next(t)
+		if at.IsZero() {
+			continue
+		}
+		if ev.At.IsZero() || at.Before(ev.At) {
+			ev = Event{At: at, Action: r.Action}
+		}
+	}
+	return ev, !ev.At.IsZero()
+}
+
+// Upcoming returns at most n events after t,
+// events of rules at the same time in order of rules
+func (s *Schedule) Upcoming(t time.Time, n int) []Event {
+	var evs []Event
+	for len(evs) < n {
+		ev, ok := s.Next(t)
+		if !ok {
+			break
+		}
+		for _, r := range s.Rules {
+			if len(evs) < n && r.Spec.Next(s.in(t)).Equal(ev.At) {
+				evs = append(evs, Event{At: ev.At, Action: r.Action})
+			}
+		}
+		t = ev.At
+	}
+	return evs
+}
+
+// Last returns the latest event within a week before or at t
+func (s *Schedule) Last(t time.Time) (Event, bool) {
+	var last Event
+	from := t.AddDate(0, 0, -7).Add(-time.Minute)
+	for {
+		ev, ok := s.Next(from)
+		if !ok || ev.At.After(t) {
+			break
+		}
+		last = ev
+		from = ev.At
+	}
+	return last, !last.At.IsZero()
+}
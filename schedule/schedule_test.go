@@ -0,0 +1,86 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecNext(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	spec, err := ParseSpec("30 23 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Date(2026, 10, 19, 23, 30, 0, 0, loc), spec.Next(time.Date(2026, 10, 19, 12, 0, 0, 0, loc)))
+	assert.Equal(t, time.Date(2026, 10, 20, 23, 30, 0, 0, loc), spec.Next(time.Date(2026, 10, 19, 23, 30, 0, 0, loc)))
+
+	// 2026-10-19 is a monday
+	spec, err = ParseSpec("*/15 7-8 * * 6,7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Date(2026, 10, 24, 7, 0, 0, 0, loc), spec.Next(time.Date(2026, 10, 19, 12, 0, 0, 0, loc)))
+	assert.Equal(t, time.Date(2026, 10, 24, 8, 45, 0, 0, loc), spec.Next(time.Date(2026, 10, 24, 8, 30, 0, 0, loc)))
+	assert.Equal(t, time.Date(2026, 10, 25, 7, 0, 0, 0, loc), spec.Next(time.Date(2026, 10, 24, 8, 45, 0, 0, loc)))
+
+	// dom or dow when both restricted
+	spec, err = ParseSpec("0 0 1 * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, time.Date(2026, 10, 26, 0, 0, 0, 0, loc), spec.Next(time.Date(2026, 10, 19, 12, 0, 0, 0, loc)))
+	assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, loc), spec.Next(time.Date(2026, 10, 26, 0, 0, 0, 0, loc)))
+
+	for _, s := range []string{"* * * *", "60 * * * *", "* 5-3 * * *", "*/0 * * * *", "a * * * *"} {
+		_, err = ParseSpec(s)
+		assert.Equal(t, ErrIllegalSpec, err, s)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w, err := ParseWindow("23:30-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, w.Contains(time.Date(2026, 10, 19, 23, 45, 0, 0, time.UTC)))
+	assert.True(t, w.Contains(time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)))
+	assert.False(t, w.Contains(time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)))
+	assert.False(t, w.Contains(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestSchedule(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	s, err := Parse("login 0 7 * * *; logout 30 23 * * *\n# comment\nquiet 00:00-06:00; relogin 0 5 * * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Location = loc
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, loc).UTC()
+	assert.Equal(t, []Event{
+		{At: time.Date(2026, 10, 19, 23, 30, 0, 0, loc), Action: ActionLogout},
+		{At: time.Date(2026, 10, 20, 7, 0, 0, 0, loc), Action: ActionLogin},
+		{At: time.Date(2026, 10, 20, 23, 30, 0, 0, loc), Action: ActionLogout},
+	}, s.Upcoming(now, 3))
+	last, ok := s.Last(now)
+	assert.True(t, ok)
+	assert.Equal(t, Event{At: time.Date(2026, 10, 19, 7, 0, 0, 0, loc), Action: ActionLogin}, last)
+	assert.True(t, s.IsQuiet(time.Date(2026, 10, 19, 1, 0, 0, 0, loc)))
+	assert.False(t, s.IsQuiet(now))
+
+	_, err = Parse("logon 0 7 * * *")
+	assert.Equal(t, ErrIllegalAction, err)
+
+	// rules at the same minute are all upcoming
+	s, err = Parse("logout 0 7 * * *; login 0 7 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Location = loc
+	assert.Equal(t, []Event{
+		{At: time.Date(2026, 10, 20, 7, 0, 0, 0, loc), Action: ActionLogout},
+		{At: time.Date(2026, 10, 20, 7, 0, 0, 0, loc), Action: ActionLogin},
+		{At: time.Date(2026, 10, 21, 7, 0, 0, 0, loc), Action: ActionLogout},
+	}, s.Upcoming(now, 3))
+}